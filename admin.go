@@ -0,0 +1,204 @@
+package log15
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// levelEntry is a logger whose level can be changed by LevelHandler.
+type levelEntry struct {
+	l       Logger
+	prev    Lvl         // level to go back to when restore fires
+	prevSet bool        // false if the level was inherited before
+	restore *time.Timer // pending end of a temporary override, nil if none
+	expires time.Time
+}
+
+var levels = struct {
+	sync.Mutex
+	m map[string]*levelEntry
+}{m: make(map[string]*levelEntry)}
+
+// RegisterLogger makes l visible to LevelHandler under name, replacing any
+// logger registered under the same name before. The root logger is
+// registered as "root".
+func RegisterLogger(name string, l Logger) {
+	levels.Lock()
+	defer levels.Unlock()
+	if e, ok := levels.m[name]; ok && e.restore != nil {
+		e.restore.Stop()
+	}
+	levels.m[name] = &levelEntry{l: l}
+}
+
+// UnregisterLogger removes the logger registered under name.
+func UnregisterLogger(name string) {
+	levels.Lock()
+	defer levels.Unlock()
+	if e, ok := levels.m[name]; ok {
+		if e.restore != nil {
+			e.restore.Stop()
+		}
+		delete(levels.m, name)
+	}
+}
+
+// SetLevelFor sets the level of the logger registered under name. If d is
+// positive the change is temporary: the previous level is restored once d
+// has passed, unless the level is set again through SetLevelFor before.
+func SetLevelFor(name string, lvl Lvl, d time.Duration) error {
+	_, err := setLevelFor(name, lvl, d)
+	return err
+}
+
+func setLevelFor(name string, lvl Lvl, d time.Duration) (LoggerLevel, error) {
+	if lvl < LvlCrit || lvl > LvlTrace {
+		return LoggerLevel{}, fmt.Errorf("invalid level %d", int(lvl))
+	}
+
+	levels.Lock()
+	defer levels.Unlock()
+	e, ok := levels.m[name]
+	if !ok {
+		return LoggerLevel{}, fmt.Errorf("unknown logger %q", name)
+	}
+
+	if e.restore != nil {
+		// a pending override is replaced, keep the level from before it
+		e.restore.Stop()
+		e.restore = nil
+		e.expires = time.Time{}
+	} else {
+		e.prev, e.prevSet = levelOf(e.l)
+	}
+
+	e.l.SetOutLevel(lvl)
+	if d > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(d, func() {
+			levels.Lock()
+			defer levels.Unlock()
+			if e.restore == t {
+				if e.prevSet {
+					e.l.SetOutLevel(e.prev)
+				} else {
+					e.l.ResetOutLevel()
+				}
+				e.restore = nil
+				e.expires = time.Time{}
+			}
+		})
+		e.restore = t
+		e.expires = time.Now().Add(d)
+	}
+	return e.describe(name), nil
+}
+
+// levelOf returns the level of l and whether it was set on l itself rather
+// than inherited from a parent.
+func levelOf(l Logger) (Lvl, bool) {
+	if ll, ok := l.(*logger); ok && ll.parent != nil {
+		return ll.GetOutLevel(), atomic.LoadInt32(&ll.setLv) != lvlUnset
+	}
+	return l.GetOutLevel(), true
+}
+
+// LoggerLevel describes a registered logger, as listed by LevelHandler.
+type LoggerLevel struct {
+	Name      string     `json:"name"`
+	Level     string     `json:"level"`
+	Inherited bool       `json:"inherited,omitempty"` // Level is the parent's
+	Expires   *time.Time `json:"expires,omitempty"`   // end of a temporary override
+	Restore   string     `json:"restore,omitempty"`   // level after Expires, "inherit" for the parent's
+}
+
+// LoggerLevels returns the registered loggers sorted by name.
+func LoggerLevels() []LoggerLevel {
+	levels.Lock()
+	defer levels.Unlock()
+	list := make([]LoggerLevel, 0, len(levels.m))
+	for name, e := range levels.m {
+		list = append(list, e.describe(name))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func (e *levelEntry) describe(name string) LoggerLevel {
+	lvl, set := levelOf(e.l)
+	ll := LoggerLevel{Name: name, Level: lvl.String(), Inherited: !set}
+	if e.restore != nil {
+		expires := e.expires
+		ll.Expires = &expires
+		ll.Restore = e.prev.String()
+		if !e.prevSet {
+			ll.Restore = "inherit"
+		}
+	}
+	return ll
+}
+
+// LevelHandler returns an http.Handler for changing log levels at runtime.
+// GET lists the registered loggers with their levels as JSON. PUT or POST
+// sets the level of one of them, given by the "logger" (default "root"),
+// "level" and optional "for" parameters, the latter making the change
+// temporary:
+//
+//     http.Handle("/debug/loglevel", log.LevelHandler())
+//
+//     curl localhost:8080/debug/loglevel
+//     curl -X PUT 'localhost:8080/debug/loglevel?logger=root&level=debug&for=10m'
+//
+// The handler performs no authentication, mount it on an internal port only.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(serveLevels)
+}
+
+func serveLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, LoggerLevels())
+
+	case http.MethodPut, http.MethodPost:
+		name := r.FormValue("logger")
+		if name == "" {
+			name = "root"
+		}
+		lvl, err := LvlFromString(r.FormValue("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var d time.Duration
+		if s := r.FormValue("for"); s != "" {
+			if d, err = time.ParseDuration(s); err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("invalid duration %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ll, err := setLevelFor(name, lvl, d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, ll)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,331 @@
+package log15
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what an AsyncHandler does with a record when its
+// queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the caller wait until there is room in the queue.
+	// This is what BufferedHandler does.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the record being logged.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued record to make room.
+	OverflowDropOldest
+	// OverflowDropBelowLevel discards the record being logged if it is less
+	// severe than the level set with WithDropLevel, and blocks otherwise.
+	OverflowDropBelowLevel
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropBelowLevel:
+		return "drop-below-level"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// AsyncStats is a snapshot of an AsyncHandler's counters.
+type AsyncStats struct {
+	Queued  int    // records waiting in the queue
+	Written uint64 // records passed to the wrapped handler without error
+	Failed  uint64 // records the wrapped handler returned an error for
+	Dropped uint64 // records discarded by the overflow policy or on close
+}
+
+// An AsyncOption configures an AsyncHandler.
+type AsyncOption func(a *asyncHandler)
+
+// WithOverflowPolicy sets what happens when the queue is full.
+// The default is OverflowBlock.
+func WithOverflowPolicy(p OverflowPolicy) AsyncOption {
+	return func(a *asyncHandler) {
+		a.policy = p
+	}
+}
+
+// WithDropLevel sets the level used by OverflowDropBelowLevel: records less
+// severe than lvl are dropped when the queue is full. The default is LvlWarn,
+// so Info and Debug records are dropped while Warn and above wait.
+func WithDropLevel(lvl Lvl) AsyncOption {
+	return func(a *asyncHandler) {
+		a.dropLvl = lvl
+	}
+}
+
+// WithErrorCallback registers fn to be called from the writer goroutine
+// with every record the wrapped handler fails to write.
+func WithErrorCallback(fn func(r *Record, err error)) AsyncOption {
+	return func(a *asyncHandler) {
+		a.onErr = fn
+	}
+}
+
+// WithDropSummary makes the handler write a Warn record through the wrapped
+// handler at most once per interval, reporting how many records were
+// dropped since the previous summary. Nothing is written while no records
+// are dropped.
+func WithDropSummary(interval time.Duration) AsyncOption {
+	return func(a *asyncHandler) {
+		a.summaryInterval = interval
+	}
+}
+
+// WithDrainTimeout bounds how long Flush and Close wait for queued records
+// to be written. Records still queued when it expires are dropped. The
+// default is five seconds.
+func WithDrainTimeout(d time.Duration) AsyncOption {
+	return func(a *asyncHandler) {
+		a.drainTimeout = d
+	}
+}
+
+// AsyncHandler writes records to a queue of the given size which a
+// background goroutine drains into the wrapped handler. Unlike
+// BufferedHandler, what happens when the queue is full is configurable,
+// dropped records are counted, and errors from the wrapped handler can be
+// observed with WithErrorCallback. For example, a gateway which must never
+// stall on a slow disk:
+//
+//     log.AsyncHandler(4096, h,
+//         log.WithOverflowPolicy(log.OverflowDropBelowLevel),
+//         log.WithDropLevel(log.LvlError),
+//         log.WithDropSummary(time.Minute))
+//
+// The returned Handler also has a Stats() AsyncStats method. Close drains
+// the queue within the drain timeout and then closes the wrapped handler.
+func AsyncHandler(bufSize int, h Handler, opts ...AsyncOption) Handler {
+	a := &asyncHandler{
+		h:            h,
+		recs:         make(chan *Record, bufSize),
+		closing:      make(chan struct{}),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+		dropLvl:      LvlWarn,
+		drainTimeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	go a.run()
+	return a
+}
+
+var errDrainTimeout = errors.New("log15: timed out draining async handler")
+
+type asyncHandler struct {
+	// 64-bit counters first to keep them aligned for atomic access
+	pending  int64 // queued or being written, for Flush
+	written  uint64
+	failed   uint64
+	dropped  uint64
+	reported uint64 // value of dropped at the last summary
+
+	h       Handler
+	recs    chan *Record
+	mu      sync.RWMutex  // held for reading by Log while it sends on recs
+	closed  bool          // guarded by mu, set by Close
+	closing chan struct{} // closed by Close to wake up blocked senders
+	quit    chan struct{} // closed by Close once no more sends can happen
+	done    chan struct{} // closed when run returns
+
+	policy          OverflowPolicy
+	dropLvl         Lvl
+	onErr           func(r *Record, err error)
+	summaryInterval time.Duration
+	drainTimeout    time.Duration
+
+	closeOnce sync.Once
+	closeErr  error // returned by every Close
+}
+
+func (a *asyncHandler) Log(r *Record) error {
+	// Close waits for the sends under the read lock, so that the writer
+	// goroutine doesn't stop before the last record is queued
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return errHandlerClosed
+	}
+
+	atomic.AddInt64(&a.pending, 1)
+	select {
+	case a.recs <- r:
+		return nil
+	default:
+	}
+
+	switch a.policy {
+	case OverflowDropNewest:
+		a.drop(1)
+		return nil
+	case OverflowDropOldest:
+		for {
+			select {
+			case a.recs <- r:
+				return nil
+			default:
+			}
+			select {
+			case <-a.recs:
+				a.drop(1)
+			default:
+			}
+		}
+	case OverflowDropBelowLevel:
+		if r.Lvl > a.dropLvl {
+			a.drop(1)
+			return nil
+		}
+	}
+
+	select {
+	case a.recs <- r:
+		return nil
+	case <-a.closing:
+		a.drop(1)
+		return errHandlerClosed
+	}
+}
+
+func (a *asyncHandler) drop(n int) {
+	atomic.AddUint64(&a.dropped, uint64(n))
+	atomic.AddInt64(&a.pending, -int64(n))
+}
+
+func (a *asyncHandler) run() {
+	defer close(a.done)
+
+	var tick <-chan time.Time
+	if a.summaryInterval > 0 {
+		t := time.NewTicker(a.summaryInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case r := <-a.recs:
+			a.write(r)
+		case <-tick:
+			a.summarize()
+		case <-a.quit:
+			a.drain(time.Now().Add(a.drainTimeout))
+			return
+		}
+	}
+}
+
+// drain writes out what is left in the queue until it is empty or the
+// deadline passes, in which case the rest is dropped.
+func (a *asyncHandler) drain(deadline time.Time) {
+	for {
+		select {
+		case r := <-a.recs:
+			if time.Now().After(deadline) {
+				a.drop(1 + len(a.recs))
+				for len(a.recs) > 0 {
+					<-a.recs
+				}
+				a.summarize()
+				return
+			}
+			a.write(r)
+		default:
+			a.summarize()
+			return
+		}
+	}
+}
+
+func (a *asyncHandler) write(r *Record) {
+	if err := a.h.Log(r); err != nil {
+		atomic.AddUint64(&a.failed, 1)
+		if a.onErr != nil {
+			a.onErr(r, err)
+		}
+	} else {
+		atomic.AddUint64(&a.written, 1)
+	}
+	atomic.AddInt64(&a.pending, -1)
+}
+
+func (a *asyncHandler) summarize() {
+	dropped := atomic.LoadUint64(&a.dropped)
+	if dropped == a.reported || a.summaryInterval <= 0 {
+		return
+	}
+	n := dropped - a.reported
+	a.reported = dropped
+
+	r := &Record{
+		Time:     GetClock().Now(),
+		Lvl:      LvlWarn,
+		Msg:      "log records dropped",
+		Ctx:      []interface{}{"dropped", n, "total_dropped", dropped, "policy", a.policy.String()},
+		KeyNames: defaultKeyNames,
+	}
+	if err := a.h.Log(r); err != nil && a.onErr != nil {
+		a.onErr(r, err)
+	}
+}
+
+func (a *asyncHandler) Stats() AsyncStats {
+	return AsyncStats{
+		Queued:  len(a.recs),
+		Written: atomic.LoadUint64(&a.written),
+		Failed:  atomic.LoadUint64(&a.failed),
+		Dropped: atomic.LoadUint64(&a.dropped),
+	}
+}
+
+// Flush waits, at most for the drain timeout, until every record logged
+// before the call has been handed to the wrapped handler, then flushes it.
+func (a *asyncHandler) Flush() error {
+	deadline := time.Now().Add(a.drainTimeout)
+	for atomic.LoadInt64(&a.pending) > 0 {
+		if time.Now().After(deadline) {
+			return errDrainTimeout
+		}
+		select {
+		case <-a.done:
+			return errHandlerClosed
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return Flush(a.h)
+}
+
+func (a *asyncHandler) Close() error {
+	a.closeOnce.Do(func() {
+		close(a.closing)
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+		close(a.quit)
+
+		// allow for one slow write in progress on top of the drain itself
+		select {
+		case <-a.done:
+			a.closeErr = Close(a.h)
+		case <-time.After(2 * a.drainTimeout):
+			a.closeErr = errDrainTimeout
+		}
+	})
+	return a.closeErr
+}
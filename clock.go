@@ -0,0 +1,98 @@
+package log15
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimeZone is the location records are stamped in unless a
+// different Clock is configured with SetClock or SetTimeZone.
+const defaultTimeZone = "Asia/Chongqing"
+
+// A Clock supplies the timestamp of every Record a Logger writes.
+// Replace it with SetClock (package-wide) or Logger.SetClock (per Logger),
+// for example to get deterministic timestamps in tests:
+//
+//     log.SetClock(log.ClockFunc(func() time.Time { return fixed }))
+//
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts an ordinary function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+type locationClock struct {
+	loc *time.Location
+}
+
+func (c locationClock) Now() time.Time {
+	return time.Now().In(c.loc)
+}
+
+// LocationClock returns a Clock that reports the current wall time in loc.
+// The location is resolved once, not on every record. A nil loc means
+// time.Local.
+func LocationClock(loc *time.Location) Clock {
+	if loc == nil {
+		loc = time.Local
+	}
+	return locationClock{loc}
+}
+
+// UTCClock returns a Clock that reports the current time in UTC.
+func UTCClock() Clock {
+	return locationClock{time.UTC}
+}
+
+// MonotonicClock returns a Clock that reports time.Now() unchanged, in the
+// process's local zone and with its monotonic clock reading intact. Durations
+// computed between such Record.Time values are immune to wall clock jumps.
+func MonotonicClock() Clock {
+	return ClockFunc(time.Now)
+}
+
+// clockHolder keeps the package-wide Clock. atomic.Value requires every
+// stored value to have the same concrete type, hence the wrapper.
+type clockHolder struct {
+	Clock
+}
+
+var pkgClock atomic.Value
+
+func init() {
+	loc, err := time.LoadLocation(defaultTimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	pkgClock.Store(clockHolder{LocationClock(loc)})
+}
+
+// SetClock replaces the Clock used by every Logger which has not been given
+// its own with Logger.SetClock. A nil c restores the process local time.
+func SetClock(c Clock) {
+	if c == nil {
+		c = LocationClock(nil)
+	}
+	pkgClock.Store(clockHolder{c})
+}
+
+// GetClock returns the package-wide Clock.
+func GetClock() Clock {
+	return pkgClock.Load().(clockHolder).Clock
+}
+
+// SetTimeZone is a shortcut for SetClock(LocationClock(loc)) with loc loaded
+// from the IANA zone database by name, e.g. "UTC" or "Europe/Berlin".
+func SetTimeZone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	SetClock(LocationClock(loc))
+	return nil
+}
@@ -0,0 +1,37 @@
+// Command log15-agent is a local stand-in for the log agent NetFileHandler
+// and UDPHandler send to. It prints every record it receives to stdout,
+// prefixed with service, sequence number, level and meta.
+//
+//     go run ./cmd/log15-agent -addr 127.0.0.1:9999
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/xuexihuang/new_log15/udpagent"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9999", "UDP address to listen on")
+	flag.Parse()
+
+	agent, err := udpagent.Listen(*addr, func(r udpagent.Record) {
+		fmt.Printf("%s v%d #%d lvl=%d meta=%v %s", r.Service, r.Version, r.Seq, r.Level, r.Meta, r.Body)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "listening on", agent.Addr())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+
+	stats := agent.Stats()
+	agent.Close()
+	fmt.Fprintf(os.Stderr, "hellos=%d records=%d lost=%d bad=%d\n", stats.Hellos, stats.Records, stats.Lost, stats.BadPackets)
+}
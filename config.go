@@ -0,0 +1,526 @@
+package log15
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-colorable"
+)
+
+// Config describes the handler tree and levels of the root logger, so that
+// they can be read from a file instead of being wired up in code:
+//
+//     {
+//         "level": "info",
+//         "loggers": {"db": "warn", "db.pool": "debug"},
+//         "handlers": [
+//             {"type": "stdout", "format": "terminal"},
+//             {"type": "file", "path": "/var/log/app.log", "rotate": "hourly", "max_backups": 72},
+//             {"type": "file", "path": "/var/log/error.log", "level": "error"},
+//             {"type": "udp", "service": "app", "addr": "127.0.0.1:9999", "protocol": 3}
+//         ]
+//     }
+//
+// Its fields carry json, yaml and toml tags, so that it can be decoded from
+// YAML or TOML as well, using the same keys: see RegisterConfigDecoder.
+type Config struct {
+	// Level of the root logger, "debug" if empty
+	Level string `json:"level" yaml:"level" toml:"level"`
+	// Loggers sets the levels of named loggers, see Named
+	Loggers map[string]string `json:"loggers" yaml:"loggers" toml:"loggers"`
+	// Handlers all receive every record of the root logger
+	Handlers []HandlerConfig `json:"handlers" yaml:"handlers" toml:"handlers"`
+}
+
+// HandlerConfig describes one handler of a Config. Type selects the handler
+// and which of the other fields apply:
+//
+//     stdout, stderr   Format
+//     file             Path and the rotation fields
+//     netfile          Path, rotation fields, Service, Addr, Protocol (NetFileHandler)
+//     udp              Service, Addr, Protocol (UDPHandler)
+//     net              Network, Addr (ReconnectingNetHandler)
+//     syslog           Tag, Facility, optionally Network and Addr for a remote daemon
+//     discard
+//
+// Level, Async and Caller apply to any type.
+type HandlerConfig struct {
+	Type   string `json:"type" yaml:"type" toml:"type"`
+	Name   string `json:"name" yaml:"name" toml:"name"`       // reported in MultiError, Type by default
+	Format string `json:"format" yaml:"format" toml:"format"` // terminal, terminal-pretty, logfmt (default), logfmt-strict, json, json-pretty, json-fast or template
+	Level  string `json:"level" yaml:"level" toml:"level"`    // drop records less severe than this
+	Async  int    `json:"async" yaml:"async" toml:"async"`    // queue size of an AsyncHandler in front, none if 0
+	Caller string `json:"caller" yaml:"caller" toml:"caller"` // "file", "func" or "stack", see CallerFileHandler etc.
+
+	Template string `json:"template" yaml:"template" toml:"template"` // pattern of the template format, see TemplateFormat
+
+	Path       string `json:"path" yaml:"path" toml:"path"`
+	MaxSize    *int   `json:"max_size" yaml:"max_size" toml:"max_size"` // megabytes
+	MaxAge     *int   `json:"max_age" yaml:"max_age" toml:"max_age"`    // days
+	MaxBackups *int   `json:"max_backups" yaml:"max_backups" toml:"max_backups"`
+	Compress   *bool  `json:"compress" yaml:"compress" toml:"compress"`
+	Mode       string `json:"mode" yaml:"mode" toml:"mode"`          // octal, e.g. "0640"
+	Rotate     string `json:"rotate" yaml:"rotate" toml:"rotate"`    // "hourly", "daily" or a duration like "15m"
+	Pattern    string `json:"pattern" yaml:"pattern" toml:"pattern"` // see WithFilenamePattern
+
+	Network  string `json:"network" yaml:"network" toml:"network"`
+	Addr     string `json:"addr" yaml:"addr" toml:"addr"`
+	Service  string `json:"service" yaml:"service" toml:"service"`
+	Protocol uint8  `json:"protocol" yaml:"protocol" toml:"protocol"` // agent protocol version, 2 or 3
+
+	Tag      string `json:"tag" yaml:"tag" toml:"tag"`
+	Facility string `json:"facility" yaml:"facility" toml:"facility"` // e.g. "local0", "user" by default
+}
+
+// ParseConfig reads a JSON Config from r. Unknown fields are an error, so
+// that misspelled settings don't go unnoticed.
+func ParseConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	c := new(Config)
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("log15: bad config: %v", err)
+	}
+	return c, nil
+}
+
+// Handler builds the handler tree described by c.
+func (c *Config) Handler() (Handler, error) {
+	hs := make([]Handler, 0, len(c.Handlers))
+	for i := range c.Handlers {
+		hc := &c.Handlers[i]
+		h, err := hc.build()
+		if err != nil {
+			for _, h := range hs {
+				Close(h)
+			}
+			return nil, fmt.Errorf("log15: handler %d (%s): %v", i, hc.Type, err)
+		}
+		name := hc.Name
+		if name == "" {
+			name = hc.Type
+		}
+		hs = append(hs, NamedHandler(name, h))
+	}
+
+	switch len(hs) {
+	case 0:
+		return DiscardHandler(), nil
+	case 1:
+		return hs[0], nil
+	default:
+		return MultiHandler(hs...), nil
+	}
+}
+
+// configured is the state installed by the last Config.Apply.
+var configured struct {
+	sync.Mutex
+	h       *configHandler
+	loggers map[string]string
+}
+
+// configHandler is a handler tree installed by Config.Apply. Records may
+// still be on their way through it after the next Apply replaced it, so
+// Close waits for them before closing the tree, and records arriving later
+// go to the root handler in effect instead.
+type configHandler struct {
+	Handler
+	mu     sync.RWMutex // held for reading while a record is logged
+	closed bool
+}
+
+func (h *configHandler) Log(r *Record) error {
+	h.mu.RLock()
+	if !h.closed {
+		defer h.mu.RUnlock()
+		return h.Handler.Log(r)
+	}
+	h.mu.RUnlock()
+
+	if cur := root.GetHandler(); cur != Handler(h) {
+		return cur.Log(r)
+	}
+	return errHandlerClosed
+}
+
+func (h *configHandler) Flush() error {
+	return Flush(h.Handler)
+}
+
+// Close waits for the records being logged, then flushes and closes the
+// tree.
+func (h *configHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	err := Flush(h.Handler)
+	if e := Close(h.Handler); e != nil {
+		err = e
+	}
+	return err
+}
+
+// Apply builds the handlers of c and installs them and the levels of c on
+// the root and named loggers. The handlers installed by a previous Apply
+// are flushed and closed once the records being logged through them are
+// written, and named loggers it configured but c doesn't go back to
+// inheriting their level. If c is invalid nothing is changed.
+func (c *Config) Apply() error {
+	lvl := LvlDebug
+	if c.Level != "" {
+		var err error
+		if lvl, err = LvlFromString(c.Level); err != nil {
+			return fmt.Errorf("log15: bad root level: %v", err)
+		}
+	}
+	lvls := make(map[string]Lvl, len(c.Loggers))
+	for name, s := range c.Loggers {
+		l, err := LvlFromString(s)
+		if err != nil {
+			return fmt.Errorf("log15: bad level of logger %q: %v", name, err)
+		}
+		lvls[name] = l
+	}
+
+	tree, err := c.Handler()
+	if err != nil {
+		return err
+	}
+	h := &configHandler{Handler: tree}
+
+	configured.Lock()
+	defer configured.Unlock()
+
+	root.SetHandler(h)
+	root.SetOutLevel(lvl)
+	for name := range configured.loggers {
+		if _, ok := c.Loggers[name]; !ok {
+			Named(name).ResetOutLevel()
+		}
+	}
+	for name, l := range lvls {
+		Named(name).SetOutLevel(l)
+	}
+
+	old := configured.h
+	configured.h, configured.loggers = h, c.Loggers
+	if old != nil {
+		return Close(old)
+	}
+	return nil
+}
+
+// LoadConfig reads a JSON Config from r and applies it, see Config.Apply.
+func LoadConfig(r io.Reader) error {
+	c, err := ParseConfig(r)
+	if err != nil {
+		return err
+	}
+	return c.Apply()
+}
+
+var configDecoders = struct {
+	sync.RWMutex
+	m map[string]func(data []byte, v interface{}) error
+}{m: make(map[string]func(data []byte, v interface{}) error)}
+
+// RegisterConfigDecoder makes LoadConfigFile and WatchConfigFile decode
+// the files whose name ends in ext, like ".yaml" or ".toml", with decode
+// rather than as JSON:
+//
+//     log.RegisterConfigDecoder(".yaml", yaml.Unmarshal) // gopkg.in/yaml.v3
+//
+func RegisterConfigDecoder(ext string, decode func(data []byte, v interface{}) error) {
+	configDecoders.Lock()
+	configDecoders.m[strings.ToLower(ext)] = decode
+	configDecoders.Unlock()
+}
+
+// LoadConfigFile reads a Config from the file at path and applies it. The
+// file is JSON unless a decoder was registered for its extension with
+// RegisterConfigDecoder.
+func LoadConfigFile(path string) error {
+	configDecoders.RLock()
+	decode := configDecoders.m[strings.ToLower(filepath.Ext(path))]
+	configDecoders.RUnlock()
+
+	if decode == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return LoadConfig(f)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c := new(Config)
+	if err := decode(data, c); err != nil {
+		return fmt.Errorf("log15: bad config: %v", err)
+	}
+	return c.Apply()
+}
+
+// WatchConfigFile loads the config file at path, then checks it for changes
+// once per interval and loads it again whenever it was modified. Errors of
+// later loads are passed to onErr, if not nil, and leave the configuration
+// in effect untouched. Call the returned function to stop watching.
+func WatchConfigFile(path string, interval time.Duration, onErr func(err error)) (stop func(), err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := LoadConfigFile(path); err != nil {
+		return nil, err
+	}
+
+	quit := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-quit:
+				return
+			}
+
+			cur, err := os.Stat(path)
+			if err != nil {
+				if onErr != nil {
+					onErr(err)
+				}
+				continue
+			}
+			if cur.ModTime().Equal(info.ModTime()) && cur.Size() == info.Size() {
+				continue
+			}
+			info = cur
+			if err := LoadConfigFile(path); err != nil && onErr != nil {
+				onErr(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+	}, nil
+}
+
+// format returns the Format of the handler, f is the file written to for
+// stdout and stderr and nil otherwise.
+func (hc *HandlerConfig) format(f *os.File) (Format, error) {
+	switch hc.Format {
+	case "":
+		if f != nil {
+			if tf := defaultTermFormat(f.Fd()); tf != nil {
+				return tf, nil
+			}
+		}
+		return LogfmtFormat(), nil
+	case "terminal":
+		return TerminalFormat(), nil
+	case "terminal-pretty":
+		return PrettyTerminalFormat(WithColor(f != nil && ColorEnabled(f.Fd()))), nil
+	case "logfmt":
+		return LogfmtFormat(), nil
+	case "logfmt-strict":
+		return LogfmtFormatEx(true), nil
+	case "json":
+		return JsonFormat(), nil
+	case "json-pretty":
+		return JsonFormatEx(true, true), nil
+	case "json-fast":
+		return FastJsonFormat(), nil
+	case "template":
+		if hc.Template == "" {
+			return nil, fmt.Errorf("template format without a template")
+		}
+		return TemplateFormat(hc.Template)
+	default:
+		return nil, fmt.Errorf("unknown format %q", hc.Format)
+	}
+}
+
+func (hc *HandlerConfig) fileOptions() ([]FileOption, error) {
+	var opts []FileOption
+	if hc.MaxSize != nil {
+		opts = append(opts, WithMaxSize(*hc.MaxSize))
+	}
+	if hc.MaxAge != nil {
+		opts = append(opts, WithMaxAge(*hc.MaxAge))
+	}
+	if hc.MaxBackups != nil {
+		opts = append(opts, WithMaxBackups(*hc.MaxBackups))
+	}
+	if hc.Compress != nil {
+		opts = append(opts, WithCompress(*hc.Compress))
+	}
+	if hc.Mode != "" {
+		mode, err := strconv.ParseUint(hc.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad mode %q", hc.Mode)
+		}
+		opts = append(opts, WithFileMode(os.FileMode(mode)))
+	}
+	if hc.Rotate != "" {
+		s, err := parseSchedule(hc.Rotate)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithRotateSchedule(s))
+	}
+	if hc.Pattern != "" {
+		opts = append(opts, WithFilenamePattern(hc.Pattern))
+	}
+	return opts, nil
+}
+
+func parseSchedule(s string) (RotateSchedule, error) {
+	switch strings.ToLower(s) {
+	case "hourly":
+		return Hourly(), nil
+	case "daily":
+		return Daily(), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("bad rotate schedule %q", s)
+	}
+	return Every(d), nil
+}
+
+func (hc *HandlerConfig) udpOptions() ([]Option, error) {
+	var opts []Option
+	if hc.Addr != "" {
+		opts = append(opts, WithDstAddr(hc.Addr))
+	}
+	if hc.Protocol != 0 {
+		opts = append(opts, WithProtocolVersion(hc.Protocol))
+	}
+	fopts, err := hc.fileOptions()
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, WithFileOptions(fopts...)), nil
+}
+
+func (hc *HandlerConfig) build() (Handler, error) {
+	var h Handler
+	var err error
+	switch hc.Type {
+	case "stdout", "stderr":
+		f, wr := os.Stdout, colorable.NewColorableStdout()
+		if hc.Type == "stderr" {
+			f, wr = os.Stderr, colorable.NewColorableStderr()
+		}
+		fmtr, err := hc.format(f)
+		if err != nil {
+			return nil, err
+		}
+		h = StreamHandler(wr, fmtr)
+
+	case "file", "netfile", "udp", "net", "syslog":
+		fmtr, err := hc.format(nil)
+		if err != nil {
+			return nil, err
+		}
+		if h, err = hc.buildOutput(fmtr); err != nil {
+			return nil, err
+		}
+
+	case "discard":
+		h = DiscardHandler()
+
+	case "":
+		return nil, errors.New("missing type")
+	default:
+		return nil, fmt.Errorf("unknown type %q", hc.Type)
+	}
+
+	switch hc.Caller {
+	case "":
+	case "file":
+		h = CallerFileHandler(h)
+	case "func":
+		h = CallerFuncHandler(h)
+	case "stack":
+		h = CallerStackHandler(LvlError, "%v", h)
+	default:
+		err = fmt.Errorf("bad caller %q", hc.Caller)
+	}
+	if err == nil && hc.Level != "" {
+		var lvl Lvl
+		if lvl, err = LvlFromString(hc.Level); err == nil {
+			h = LvlFilterHandler(lvl, h)
+		}
+	}
+	if err != nil {
+		Close(h)
+		return nil, err
+	}
+
+	if hc.Async > 0 {
+		h = AsyncHandler(hc.Async, h)
+	}
+	return h, nil
+}
+
+// buildOutput builds the handlers writing to files or the network.
+func (hc *HandlerConfig) buildOutput(fmtr Format) (Handler, error) {
+	switch hc.Type {
+	case "file":
+		if hc.Path == "" {
+			return nil, errors.New("missing path")
+		}
+		opts, err := hc.fileOptions()
+		if err != nil {
+			return nil, err
+		}
+		return FileHandler(hc.Path, fmtr, opts...)
+
+	case "netfile", "udp":
+		if hc.Type == "netfile" && hc.Path == "" {
+			return nil, errors.New("missing path")
+		}
+		opts, err := hc.udpOptions()
+		if err != nil {
+			return nil, err
+		}
+		if hc.Type == "netfile" {
+			return NetFileHandler(hc.Path, hc.Service, fmtr, opts...)
+		}
+		return UDPHandler(hc.Service, fmtr, opts...)
+
+	case "net":
+		if hc.Addr == "" {
+			return nil, errors.New("missing addr")
+		}
+		network := hc.Network
+		if network == "" {
+			network = "tcp"
+		}
+		return ReconnectingNetHandler(network, hc.Addr, fmtr), nil
+
+	default: // syslog
+		return syslogFromConfig(hc, fmtr)
+	}
+}
@@ -0,0 +1,9 @@
+// +build windows plan9
+
+package log15
+
+import "errors"
+
+func syslogFromConfig(hc *HandlerConfig, fmtr Format) (Handler, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,34 @@
+// +build !windows,!plan9
+
+package log15
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+func syslogFromConfig(hc *HandlerConfig, fmtr Format) (Handler, error) {
+	facility := syslog.LOG_USER
+	if hc.Facility != "" {
+		var ok bool
+		if facility, ok = syslogFacilities[hc.Facility]; !ok {
+			return nil, fmt.Errorf("unknown syslog facility %q", hc.Facility)
+		}
+	}
+	if hc.Addr != "" {
+		network := hc.Network
+		if network == "" {
+			network = "udp"
+		}
+		return SyslogNetHandler(network, hc.Addr, facility, hc.Tag, fmtr)
+	}
+	return SyslogHandler(facility, hc.Tag, fmtr)
+}
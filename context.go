@@ -0,0 +1,118 @@
+package log15
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+type reqIDCtxKey struct{}
+
+type fieldsCtxKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the given request ID.
+// Records written through the *Ctx logging methods, or by a Logger obtained
+// from WithContext, report it as Record.RequestID.
+func ContextWithRequestID(ctx context.Context, id interface{}) context.Context {
+	return context.WithValue(ctx, reqIDCtxKey{}, reqIDString(id))
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by
+// ContextWithRequestID. A nil ctx carries none.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(reqIDCtxKey{}).(string)
+	return id, ok
+}
+
+// ContextWithFields returns a copy of ctx carrying the given key/value pairs
+// in addition to any fields already stored in ctx. They are added to the
+// context of every record logged with the returned context.
+func ContextWithFields(ctx context.Context, kv ...interface{}) context.Context {
+	return context.WithValue(ctx, fieldsCtxKey{}, newContext(FieldsFromContext(ctx), kv))
+}
+
+// FieldsFromContext returns the key/value pairs stored in ctx by
+// ContextWithFields. A nil ctx carries none.
+func FieldsFromContext(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsCtxKey{}).([]interface{})
+	return fields
+}
+
+// requestMeta resolves the request ID and the extra fields of a record
+// from bound, the context bound by WithContext, and ctx, the one passed to
+// a *Ctx method. Either may be nil. The fields of both are used, bound's
+// first; the request ID of ctx wins over bound's, and the per-goroutine
+// store of SetReqMetaForGoroutine is only consulted when neither carries
+// one.
+func requestMeta(bound, ctx context.Context) (reqID string, fields []interface{}) {
+	if ctx == bound {
+		ctx = nil
+	}
+	reqID, _ = RequestIDFromContext(ctx)
+	if reqID == "" {
+		reqID, _ = RequestIDFromContext(bound)
+	}
+	fields = FieldsFromContext(ctx)
+	if bf := FieldsFromContext(bound); len(bf) > 0 {
+		switch {
+		case len(fields) == 0:
+			fields = bf
+		case !hasFieldsPrefix(fields, bf):
+			// unless ctx was derived from bound and has its fields already
+			fields = newContext(bf, fields)
+		}
+	}
+	if reqID != "" {
+		return
+	}
+
+	meta, ok := getReqMetaForGoroutine()
+	if !ok {
+		return
+	}
+	m := meta.(storeMeta)
+	reqID = reqIDString(m.reqID)
+	if fields == nil && m.reqContext != nil {
+		fields = FieldsFromContext(m.reqContext)
+	}
+	return
+}
+
+// hasFieldsPrefix reports whether fields starts with the pairs of prefix.
+func hasFieldsPrefix(fields, prefix []interface{}) bool {
+	if len(fields) < len(prefix) {
+		return false
+	}
+	for i, v := range prefix {
+		w := fields[i]
+		if v == nil || w == nil {
+			if v != w {
+				return false
+			}
+			continue
+		}
+		if !reflect.TypeOf(v).Comparable() || !reflect.TypeOf(w).Comparable() || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func reqIDString(id interface{}) string {
+	switch id := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	case fmt.Stringer:
+		return id.String()
+	default:
+		return fmt.Sprint(id)
+	}
+}
@@ -62,6 +62,22 @@ This will output a log line that includes the path context that is attached to t
 
     lvl=dbug t=2014-05-02T16:07:23-0700 path=/repo/12/add_hook msg="db txn commit" duration=0.12
 
+A logger created with New uses the level of the logger it was created from until
+SetOutLevel is called on it.
+
+
+Named loggers
+
+Named returns a logger from a dotted hierarchy rooted at the root logger. Levels and handlers
+set on a named logger apply to its whole subtree unless overridden further down:
+
+    log.Named("db").SetOutLevel(log.LvlWarn)
+    log.Named("db.pool").Info("connection opened")   // suppressed, inherited from "db"
+    log.Named("db.pool").SetOutLevel(log.LvlDebug)
+    log.Named("db.pool").Info("connection opened")   // written, with logger=db.pool
+
+Named loggers can also be changed at runtime through LevelHandler.
+
 
 Handlers
 
@@ -92,34 +108,34 @@ or above in JSON formatted output to the file /var/log/service.json
 
 Logging File Names and Line Numbers
 
-//This package implements three Handlers that add debugging information to the
-//context, CallerFileHandler, CallerFuncHandler and CallerStackHandler. Here's
-//an example that adds the source file and line number of each logging call to
-//the context.
-//
-//    h := log.CallerFileHandler(log.StdoutHandler)
-//    log.Root().SetHandler(h)
-//    ...
-//    log.Error("open file", "err", err)
-//
-//This will output a line that looks like:
-//
-//    lvl=eror t=2014-05-02T16:07:23-0700 msg="open file" err="file not found" caller=data.go:42
-//
-//Here's an example that logs the call stack rather than just the call site.
-//
-//    h := log.CallerStackHandler("%+v", log.StdoutHandler)
-//    log.Root().SetHandler(h)
-//    ...
-//    log.Error("open file", "err", err)
-//
-//This will output a line that looks like:
-//
-//    lvl=eror t=2014-05-02T16:07:23-0700 msg="open file" err="file not found" stack="[pkg/data.go:42 pkg/cmd/main.go]"
-//
-//The "%+v" format instructs the handler to include the path of the source file
-//relative to the compile time GOPATH. The github.com/go-stack/stack package
-//documents the full list of formatting verbs and modifiers available.
+This package implements three Handlers that add debugging information to the
+context, CallerFileHandler, CallerFuncHandler and CallerStackHandler. Here's
+an example that adds the source file and line number of each logging call to
+the context.
+
+    h := log.CallerFileHandler(log.StdoutHandler)
+    log.Root().SetHandler(h)
+    ...
+    log.Error("open file", "err", err)
+
+This will output a line that looks like:
+
+    lvl=eror t=2014-05-02T16:07:23-0700 msg="open file" err="file not found" caller=data.go:42
+
+Here's an example that logs the call stack of Error and Crit records rather than just the call site.
+
+    h := log.CallerStackHandler(log.LvlError, "%v", log.StdoutHandler)
+    log.Root().SetHandler(h)
+    ...
+    log.Error("open file", "err", err)
+
+This will output a line that looks like:
+
+    lvl=eror t=2014-05-02T16:07:23-0700 msg="open file" err="file not found" stack="[data.go:42 main.go:12]"
+
+The stack is captured when the record is logged, for LvlError and above by default, see
+SetStackCaptureLevel. The "%+v" format includes the full path of each source file and "%n"
+prints function names instead; see Call for the full list of formatting verbs and modifiers.
 
 Custom Handlers
 
@@ -196,7 +212,13 @@ Terminal Format
 If log15 detects that stdout is a terminal, it will configure the default
 handler for it (which is log.StdoutHandler) to use TerminalFormat. This format
 logs records nicely for your terminal, including color-coded output based
-on log level.
+on log level. The colors are left out if the NO_COLOR environment variable
+is set, and forced with FORCE_COLOR even if stdout is not a terminal, see
+ColorEnabled.
+
+PrettyTerminalFormat goes further for local debugging: it aligns the context
+after the message, colors keys and values differently and marks errors in
+red.
 
 Error Handling
 
@@ -298,6 +320,15 @@ Tab example, we would prefer to set up our Logger like so:
 Now we'll have a unique traceable identifier even across loading new urls, but
 we'll still be able to see the tab's current url in the log messages.
 
+Flushing and closing
+
+Handlers which buffer records or hold files and sockets implement the optional Flusher and
+Closer interfaces. The handlers in this package that wrap others, like MultiHandler or
+LvlFilterHandler, forward both calls to what they wrap, so flushing and closing the root
+handler reaches the whole tree. Do it before your program exits:
+
+    defer log.Shutdown(context.Background())
+
 Must
 
 For all Handler functions which can return an error, there is a version of that
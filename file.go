@@ -0,0 +1,354 @@
+package log15
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2" // --[stevenmi]
+)
+
+// fileConf holds the rotation settings of one file handler. It starts out
+// as a copy of the package defaults set with SetRotatePara.
+type fileConf struct {
+	maxSize    int // megabytes
+	maxAge     int // days
+	maxBackups int
+	compress   bool
+	localTime  bool
+	mode       os.FileMode
+	schedule   RotateSchedule // time-based rotation, see rotate.go
+	pattern    string
+}
+
+func defaultFileConf() fileConf {
+	return fileConf{
+		maxSize:    rotateConf.MaxSize,
+		maxAge:     rotateConf.MaxAge,
+		maxBackups: rotateConf.MaxBackup,
+		compress:   rotateConf.Compress,
+		localTime:  true,
+	}
+}
+
+// A FileOption overrides a rotation setting for a single FileHandler or
+// NetFileHandler, leaving the package defaults of SetRotatePara alone.
+type FileOption func(c *fileConf)
+
+// WithMaxSize rotates the file once it grows beyond mb megabytes, 0 turns
+// rotation by size off.
+func WithMaxSize(mb int) FileOption {
+	return func(c *fileConf) {
+		c.maxSize = mb
+	}
+}
+
+// WithMaxAge removes rotated files older than the given number of days,
+// 0 keeps them regardless of age.
+func WithMaxAge(days int) FileOption {
+	return func(c *fileConf) {
+		c.maxAge = days
+	}
+}
+
+// WithMaxBackups keeps at most n rotated files, 0 keeps all of them.
+func WithMaxBackups(n int) FileOption {
+	return func(c *fileConf) {
+		c.maxBackups = n
+	}
+}
+
+// WithCompress sets whether rotated files are gzipped.
+func WithCompress(compress bool) FileOption {
+	return func(c *fileConf) {
+		c.compress = compress
+	}
+}
+
+// WithLocalTime sets whether the timestamps in rotated file names use
+// local time rather than UTC. It is on by default.
+func WithLocalTime(local bool) FileOption {
+	return func(c *fileConf) {
+		c.localTime = local
+	}
+}
+
+// WithFileMode sets the permissions of a newly created log file. Rotated
+// files keep the mode of the file they replace.
+func WithFileMode(mode os.FileMode) FileOption {
+	return func(c *fileConf) {
+		c.mode = mode
+	}
+}
+
+// A logFile is a rotating log file registered for LogRotate.
+type logFile interface {
+	io.WriteCloser
+	Rotate() error
+	// Reopen closes the file and opens it again under the same name,
+	// creating it if it was removed.
+	Reopen() error
+	// current returns the name of the file being written.
+	current() string
+}
+
+// lumberjackFile is the size-rotating writer of a file handler.
+type lumberjackFile struct {
+	*lumberjack.Logger
+	mode os.FileMode
+}
+
+func (f *lumberjackFile) Reopen() error {
+	if err := f.Logger.Close(); err != nil {
+		return err
+	}
+	if f.mode != 0 {
+		if err := createWithMode(f.Filename, f.mode); err != nil {
+			return err
+		}
+	}
+	// lumberjack opens the file lazily, make it do so now
+	_, err := f.Logger.Write(nil)
+	return err
+}
+
+// Rotate rotates the file and opens the new one again in append mode,
+// which lumberjack doesn't, so that other handlers writing to the same
+// file don't have their lines overwritten.
+func (f *lumberjackFile) Rotate() error {
+	if err := f.Logger.Rotate(); err != nil {
+		return err
+	}
+	return f.Reopen()
+}
+
+func (f *lumberjackFile) current() string {
+	return f.Filename
+}
+
+// files holds the open files of every FileHandler and NetFileHandler by
+// absolute path. Several handlers may write to the same file, e.g. while a
+// configuration is reloaded, so each path has a list, oldest first.
+var files = struct {
+	sync.Mutex
+	m map[string][]*registeredFile
+}{m: make(map[string][]*registeredFile)}
+
+// fileKey returns the registry key of path, so that different spellings of
+// the same path find the same files.
+func fileKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// registeredFile removes itself from the registry when closed.
+type registeredFile struct {
+	logFile
+	key string
+}
+
+func (f *registeredFile) Close() error {
+	files.Lock()
+	open := files.m[f.key]
+	for i, rf := range open {
+		if rf == f {
+			open = append(open[:i:i], open[i+1:]...)
+			break
+		}
+	}
+	if len(open) == 0 {
+		delete(files.m, f.key)
+	} else {
+		files.m[f.key] = open
+	}
+	files.Unlock()
+	return f.logFile.Close()
+}
+
+func registerFile(path string, f logFile) logFile {
+	rf := &registeredFile{f, fileKey(path)}
+	files.Lock()
+	files.m[rf.key] = append(files.m[rf.key], rf)
+	files.Unlock()
+	return rf
+}
+
+// rotateFiles rotates the newest of the files open at one path and makes
+// the others follow it to the new file, so that the path is rotated once.
+// It returns the first error encountered.
+func rotateFiles(open []*registeredFile) error {
+	err := open[len(open)-1].Rotate()
+	for _, f := range open[:len(open)-1] {
+		if e := f.Reopen(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openLogFile creates the rotating writer for a file handler and registers
+// it so that LogRotate and RotateFile reach it.
+func openLogFile(path string, opts []FileOption) (logFile, error) {
+	c := defaultFileConf()
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.schedule != nil {
+		return registerFile(path, newTimeRotatingFile(path, c)), nil
+	}
+
+	if c.mode != 0 {
+		if err := createWithMode(path, c.mode); err != nil {
+			return nil, err
+		}
+	}
+
+	maxSize := c.maxSize
+	if maxSize <= 0 {
+		// lumberjack takes 0 for its default of 100 MB
+		maxSize = math.MaxInt32
+	}
+	f := &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    maxSize, // megabytes
+		MaxBackups: c.maxBackups,
+		MaxAge:     c.maxAge, // days
+		Compress:   c.compress,
+		LocalTime:  c.localTime,
+	}
+	return registerFile(path, &lumberjackFile{f, c.mode}), nil
+}
+
+// createWithMode creates path with exactly the given mode, regardless of
+// the umask, unless it exists already.
+func createWithMode(path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if os.IsExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Chmod(path, mode)
+}
+
+// LogRotate rotates the files of every open FileHandler and NetFileHandler.
+func LogRotate() {
+	files.Lock()
+	defer files.Unlock()
+	for _, open := range files.m {
+		rotateFiles(open)
+	}
+}
+
+// RotateFile rotates the file at path if a FileHandler or NetFileHandler
+// writes to it, however the path was spelled when opening it. It returns
+// os.ErrNotExist otherwise.
+func RotateFile(path string) error {
+	files.Lock()
+	defer files.Unlock()
+	open, ok := files.m[fileKey(path)]
+	if !ok {
+		return os.ErrNotExist
+	}
+	return rotateFiles(open)
+}
+
+// ReopenFiles closes the files of every open FileHandler and NetFileHandler
+// and opens them again under the same name. Call it after an external tool
+// such as logrotate moved the files away, so that logging continues in new
+// files instead of the moved ones. It returns the first error encountered.
+func ReopenFiles() error {
+	files.Lock()
+	defer files.Unlock()
+	var err error
+	for _, open := range files.m {
+		for _, f := range open {
+			if e := f.Reopen(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// WatchFiles checks the files of every open FileHandler and NetFileHandler
+// once per interval and reopens those which were deleted or replaced by
+// another file, so that nothing is written to an unlinked inode. Call the
+// returned function to stop watching.
+func WatchFiles(interval time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		seen := make(map[string]os.FileInfo)
+		for {
+			select {
+			case <-t.C:
+				checkFiles(seen)
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(quit) })
+	}
+}
+
+// checkFiles reopens the registered files whose name no longer refers to
+// the file seen at the previous check.
+func checkFiles(seen map[string]os.FileInfo) {
+	files.Lock()
+	open := make([]logFile, 0, len(files.m))
+	for _, fs := range files.m {
+		for _, f := range fs {
+			open = append(open, f)
+		}
+	}
+	files.Unlock()
+
+	// handlers sharing a file are reopened together
+	byName := make(map[string][]logFile, len(open))
+	for _, f := range open {
+		if name := f.current(); name != "" {
+			byName[name] = append(byName[name], f)
+		}
+	}
+
+	for name, fs := range byName {
+		info, err := os.Stat(name)
+		prev, ok := seen[name]
+		if os.IsNotExist(err) || (err == nil && ok && !os.SameFile(prev, info)) {
+			for _, f := range fs {
+				if err := f.Reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "log15: failed to reopen %s: %v\n", name, err)
+				}
+			}
+			info, err = os.Stat(name)
+		}
+		if err == nil {
+			seen[name] = info
+		} else {
+			delete(seen, name)
+		}
+	}
+
+	for name := range seen {
+		if _, ok := byName[name]; !ok {
+			delete(seen, name)
+		}
+	}
+}
@@ -17,7 +17,7 @@ const (
 	timeFormat     = "2006-01-02 15:04:05.000"
 	termTimeFormat = "01-02|15:04:05"
 	floatFormat    = 'f'
-	termMsgJust    = 40
+	termCtxColumn  = 80
 
 	// DurationFieldUnit defines the unit for time.Duration type fields added
 	// using the Dur method.
@@ -30,9 +30,12 @@ const (
 
 var (
 	enc     structured.Encoder
+	lfenc   structured.LogfmtEncoder
+	// bufPool holds *[]byte, a pointer so that Put doesn't allocate
 	bufPool = &sync.Pool{
 		New: func() interface{} {
-			return make([]byte, 0, 256)
+			buf := make([]byte, 0, 256)
+			return &buf
 		},
 	}
 )
@@ -64,19 +67,15 @@ func (f formatFunc) Format(r *Record) []byte {
 //     [May 16 20:58:45] [DBUG] remove route ns=haproxy addr=127.0.0.1:50002
 //
 func TerminalFormat() Format {
+	return terminalFormat(true)
+}
+
+// terminalFormat is TerminalFormat, without colors if colored is false.
+func terminalFormat(colored bool) Format {
 	return FormatFunc(func(r *Record) []byte {
 		var color = 0
-		switch r.Lvl {
-		case LvlCrit:
-			color = 35
-		case LvlError:
-			color = 31
-		case LvlWarn:
-			color = 33
-		case LvlInfo:
-			color = 32
-		case LvlDebug:
-			color = 36
+		if colored {
+			color = lvlColor(r.Lvl)
 		}
 
 		var buf = make([]byte, 0, 256)
@@ -112,6 +111,25 @@ func TerminalFormat() Format {
 	})
 }
 
+// lvlColor returns the terminal color code of records at lvl.
+func lvlColor(lvl Lvl) int {
+	switch lvl {
+	case LvlCrit:
+		return 35
+	case LvlError:
+		return 31
+	case LvlWarn:
+		return 33
+	case LvlInfo:
+		return 32
+	case LvlDebug:
+		return 36
+	case LvlTrace:
+		return 34
+	}
+	return 0
+}
+
 // LogfmtFormat prints records in logfmt format, an easy machine-parseable but human-readable
 // format for key/value pairs.
 //
@@ -119,11 +137,6 @@ func TerminalFormat() Format {
 //
 func LogfmtFormat() Format {
 	return FormatFunc(func(r *Record) []byte {
-		// assignment in serial processing
-		logLevel = byte(r.Lvl)
-		logMetaKey = r.MetaK
-		logMetaValue = r.MetaV
-
 		var caller string
 		if r.CustomCaller == "" {
 			caller = r.Call
@@ -159,6 +172,54 @@ func LogfmtFormat() Format {
 	})
 }
 
+// LogfmtFormatEx is LogfmtFormat if strict is false. If strict is true it
+// prints records as plain logfmt lines that standard logfmt parsers read
+// without special cases: the header becomes key/value pairs, values are
+// quoted only where needed, and maps, structs and slices in the context
+// are flattened into dotted keys.
+//
+//     t=2026-10-16T14:02:03.120+08:00 lvl=info call=main.go:12 msg="user login" user.id=7 user.name=bob
+//
+func LogfmtFormatEx(strict bool) Format {
+	if !strict {
+		return LogfmtFormat()
+	}
+	return FormatFunc(func(r *Record) []byte {
+		caller := r.Call
+		if r.CustomCaller != "" {
+			caller = r.CustomCaller
+		}
+
+		var buf = make([]byte, 0, 256)
+
+		buf = lfenc.AppendField(buf, r.KeyNames.Time, r.Time)
+		buf = append(buf, ' ')
+		buf = lfenc.AppendField(buf, r.KeyNames.Lvl, r.Lvl.String())
+		if caller != "" {
+			buf = append(buf, ' ')
+			buf = lfenc.AppendField(buf, r.KeyNames.Call, caller)
+		}
+		if r.RequestID != "" {
+			buf = append(buf, ' ')
+			buf = lfenc.AppendField(buf, r.KeyNames.ReqID, r.RequestID)
+		}
+		buf = append(buf, ' ')
+		buf = lfenc.AppendField(buf, r.KeyNames.Msg, r.Msg)
+
+		for i := 0; i < len(r.Ctx); i += 2 {
+			k, ok := r.Ctx[i].(string)
+			v := r.Ctx[i+1]
+			if !ok {
+				k, v = errorKey, fmt.Sprintf("%+v is not a string key", r.Ctx[i])
+			}
+			buf = append(buf, ' ')
+			buf = lfenc.AppendField(buf, k, v)
+		}
+
+		return append(buf, '\n')
+	})
+}
+
 func logfmt(buf []byte, ctx []interface{}, color int) []byte {
 	var sz = len(ctx)
 	for i := 0; i < sz; i += 2 {
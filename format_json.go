@@ -0,0 +1,163 @@
+package log15
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// maxPooledBuf is the capacity above which a buffer isn't returned to
+// bufPool, so that one huge record doesn't pin its buffer.
+const maxPooledBuf = 64 << 10
+
+// FastJsonFormat formats log records as JSON objects separated by newlines,
+// like JsonFormat, but appends the fields straight into a pooled buffer
+// instead of building a map and running encoding/json over it. Unlike
+// JsonFormat it keeps the order of the context, writes the caller and
+// the request ID, and encodes structs, maps and slices as nested JSON
+// rather than strings:
+//
+//     {"t":"2026-10-16T14:02:03.120+08:00","lvl":"info","call":"main.go:12","reqid":"8f2a","msg":"login","user":{"id":7,"name":"bob"},"ok":true}
+//
+// Values implementing json.Marshaler are encoded with it, other errors and
+// fmt.Stringers as their string.
+//
+// Records of primitive values are encoded without intermediate
+// allocations; the one allocation per record left is the returned line,
+// copied out of the pooled buffer because a Format's result may be kept
+// by the caller.
+func FastJsonFormat() Format {
+	return FormatFunc(func(r *Record) []byte {
+		bp := bufPool.Get().(*[]byte)
+		buf := (*bp)[:0]
+
+		buf = append(buf, '{')
+		buf = enc.AppendString(buf, r.KeyNames.Time)
+		buf = append(buf, ':', '"')
+		buf = enc.AppendTime(buf, r.Time, jsonTimeFormat)
+		buf = append(buf, '"', ',')
+		buf = enc.AppendString(buf, r.KeyNames.Lvl)
+		buf = append(buf, ':')
+		buf = enc.AppendString(buf, r.Lvl.String())
+		if r.Call != "" {
+			buf = append(buf, ',')
+			buf = enc.AppendString(buf, r.KeyNames.Call)
+			buf = append(buf, ':')
+			buf = enc.AppendString(buf, r.Call)
+		}
+		if r.RequestID != "" {
+			buf = append(buf, ',')
+			buf = enc.AppendString(buf, r.KeyNames.ReqID)
+			buf = append(buf, ':')
+			buf = enc.AppendString(buf, r.RequestID)
+		}
+		buf = append(buf, ',')
+		buf = enc.AppendString(buf, r.KeyNames.Msg)
+		buf = append(buf, ':')
+		buf = enc.AppendString(buf, r.Msg)
+
+		for i := 0; i < len(r.Ctx); i += 2 {
+			k, ok := r.Ctx[i].(string)
+			v := r.Ctx[i+1]
+			if !ok {
+				k, v = errorKey, fmt.Sprintf("%+v is not a string key", r.Ctx[i])
+			}
+			buf = append(buf, ',')
+			buf = enc.AppendString(buf, k)
+			buf = append(buf, ':')
+			buf = appendJsonVal(buf, v)
+		}
+		buf = append(buf, '}', '\n')
+
+		// the pooled buffer goes back, the caller gets a copy of its size
+		// since a Format's result may be kept
+		out := make([]byte, len(buf))
+		copy(out, buf)
+		if cap(buf) <= maxPooledBuf {
+			*bp = buf
+			bufPool.Put(bp)
+		}
+		return out
+	})
+}
+
+// appendJsonVal appends val as a JSON value.
+func appendJsonVal(dst []byte, val interface{}) []byte {
+	switch val := val.(type) {
+	case nil:
+		return append(dst, "null"...)
+	case string:
+		return enc.AppendString(dst, val)
+	case []byte:
+		return enc.AppendBytes(dst, val)
+	case bool:
+		return enc.AppendBool(dst, val)
+	case int:
+		return enc.AppendInt(dst, val)
+	case int8:
+		return enc.AppendInt8(dst, val)
+	case int16:
+		return enc.AppendInt16(dst, val)
+	case int32:
+		return enc.AppendInt32(dst, val)
+	case int64:
+		return enc.AppendInt64(dst, val)
+	case uint:
+		return enc.AppendUint(dst, val)
+	case uint8:
+		return enc.AppendUint8(dst, val)
+	case uint16:
+		return enc.AppendUint16(dst, val)
+	case uint32:
+		return enc.AppendUint32(dst, val)
+	case uint64:
+		return enc.AppendUint64(dst, val)
+	case float32:
+		return enc.AppendFloat32(dst, val)
+	case float64:
+		return enc.AppendFloat64(dst, val)
+	case time.Time:
+		dst = append(dst, '"')
+		dst = enc.AppendTime(dst, val, jsonTimeFormat)
+		return append(dst, '"')
+	case time.Duration:
+		return enc.AppendDuration(dst, val, DurationFieldUnit, DurationFieldInteger)
+	case []string:
+		return enc.AppendStrings(dst, val)
+	case []bool:
+		return enc.AppendBools(dst, val)
+	case []int:
+		return enc.AppendInts(dst, val)
+	case []int64:
+		return enc.AppendInts64(dst, val)
+	case []uint64:
+		return enc.AppendUints64(dst, val)
+	case []error:
+		dst = enc.AppendArrayStart(dst)
+		for i, err := range val {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJsonVal(dst, err)
+		}
+		return enc.AppendArrayEnd(dst)
+	}
+
+	if v := reflect.ValueOf(val); (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return append(dst, "null"...)
+	}
+
+	switch v := val.(type) {
+	case json.Marshaler:
+		return enc.AppendInterface(dst, v)
+	case error:
+		return enc.AppendString(dst, v.Error())
+	case fmt.Stringer:
+		return enc.AppendString(dst, v.String())
+	default:
+		return enc.AppendInterface(dst, v)
+	}
+}
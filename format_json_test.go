@@ -0,0 +1,77 @@
+package log15
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func benchRecord() *Record {
+	return &Record{
+		Time:      time.Date(2026, 10, 16, 14, 2, 3, 120e6, time.UTC),
+		Lvl:       LvlInfo,
+		Msg:       "user login",
+		Call:      "main.go:12",
+		RequestID: "8f2a",
+		KeyNames:  defaultKeyNames,
+		Ctx: []interface{}{
+			"user", "bob",
+			"id", 7,
+			"ok", true,
+			"ratio", 0.25,
+			"took", 1500 * time.Millisecond,
+			"err", errors.New("connection refused"),
+		},
+	}
+}
+
+func TestFastJsonFormat(t *testing.T) {
+	r := benchRecord()
+	r.Ctx = append(r.Ctx, "tags", []string{"a", "b"}, "meta", map[string]int{"n": 1}, "none", nil)
+
+	out := FastJsonFormat().Format(r)
+	var m map[string]interface{}
+	if err := json.Unmarshal(out, &m); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	want := map[string]interface{}{
+		"t":     "2026-10-16T14:02:03.120Z",
+		"lvl":   "info",
+		"call":  "main.go:12",
+		"reqid": "8f2a",
+		"msg":   "user login",
+		"user":  "bob",
+		"id":    7.0,
+		"ok":    true,
+		"err":   "connection refused",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %v, want %v", k, m[k], v)
+		}
+	}
+	if _, ok := m["meta"].(map[string]interface{}); !ok {
+		t.Errorf("meta = %v, want a nested object", m["meta"])
+	}
+	if v, ok := m["none"]; !ok || v != nil {
+		t.Errorf("none = %v, want null", v)
+	}
+}
+
+func BenchmarkFastJsonFormat(b *testing.B) {
+	benchmarkFormat(b, FastJsonFormat())
+}
+
+func BenchmarkJsonFormat(b *testing.B) {
+	benchmarkFormat(b, JsonFormat())
+}
+
+func benchmarkFormat(b *testing.B, f Format) {
+	r := benchRecord()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Format(r)
+	}
+}
@@ -0,0 +1,277 @@
+package log15
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A HeaderPart is a part of the head of a line written by LogfmtFormatWith
+// or TerminalFormatWith, see WithHeader.
+type HeaderPart int
+
+const (
+	HeaderTime   HeaderPart = iota // [2026-10-16 14:02:03.120]
+	HeaderLvl                      // [info], or INFO in color on a terminal
+	HeaderCaller                   // [main.go:12], left out if empty
+	HeaderReqID                    // [reqid=8f2a], left out without a request ID
+	HeaderMsg                      // msg="user login"
+)
+
+// A FormatOption changes the layout of LogfmtFormatWith and
+// TerminalFormatWith.
+type FormatOption func(c *formatConf)
+
+type formatConf struct {
+	timeLayout string
+	header     []HeaderPart
+	keyNames   RecordKeyNames
+	lvlName    func(Lvl) string
+	strict     bool
+	color      bool
+}
+
+// WithTimeLayout sets the layout of the time in the head of a line, a
+// time.Format layout or one of "UNIX", "UNIXMS" and "UNIXMICRO" for the
+// seconds, milliseconds or microseconds since the Unix epoch.
+func WithTimeLayout(layout string) FormatOption {
+	return func(c *formatConf) {
+		c.timeLayout = layout
+	}
+}
+
+// WithHeader sets which parts make up the head of a line, and in which
+// order. Parts left out aren't written. The context always comes last:
+//
+//     log.LogfmtFormatWith(log.WithHeader(log.HeaderLvl, log.HeaderTime, log.HeaderMsg))
+//
+func WithHeader(parts ...HeaderPart) FormatOption {
+	return func(c *formatConf) {
+		c.header = parts
+	}
+}
+
+// WithKeyNames overrides the key names of the record's own fields. Msg and
+// ReqID rename the "msg" and "reqid" keys. The time, level and caller are
+// written bare in the head, "[info]"; naming them writes them as
+// "[lvl=info]" instead. Empty names keep the default.
+func WithKeyNames(names RecordKeyNames) FormatOption {
+	return func(c *formatConf) {
+		c.keyNames = names
+	}
+}
+
+// WithLevelNames sets how levels are named, Lvl.String for logfmt and its
+// upper case for terminals by default. Use Lvl.LongName for "DEBUG"
+// instead of "dbug".
+func WithLevelNames(name func(Lvl) string) FormatOption {
+	return func(c *formatConf) {
+		c.lvlName = name
+	}
+}
+
+// WithStrictLogfmt sets whether the message and the context are encoded
+// as plain logfmt, quoting values only where needed and flattening nested
+// ones, see LogfmtFormatEx. It is off by default.
+func WithStrictLogfmt(strict bool) FormatOption {
+	return func(c *formatConf) {
+		c.strict = strict
+	}
+}
+
+// WithColors sets whether TerminalFormatWith colors the level, the message
+// and the keys. By default it does if ColorEnabled(os.Stdout.Fd()), that
+// is if stdout is a terminal and the NO_COLOR environment variable isn't
+// set. LogfmtFormatWith never colors.
+func WithColors(color bool) FormatOption {
+	return func(c *formatConf) {
+		c.color = color
+	}
+}
+
+// LogfmtFormatWith is LogfmtFormat with the layout changed by opts. Without
+// options it writes the same lines, except that the request ID is
+// separated from the caller by a single space and an empty caller is left
+// out rather than written as "[]".
+func LogfmtFormatWith(opts ...FormatOption) Format {
+	c := newFormatConf(opts,
+		[]HeaderPart{HeaderTime, HeaderLvl, HeaderCaller, HeaderReqID, HeaderMsg},
+		Lvl.String)
+	return FormatFunc(func(r *Record) []byte {
+		var buf = make([]byte, 0, 256)
+		buf = c.appendHead(buf, r, 0, false)
+		return c.appendCtx(buf, r.Ctx, 0)
+	})
+}
+
+// TerminalFormatWith is TerminalFormat with the layout changed by opts.
+// The level is colored instead of bracketed, see WithColors.
+func TerminalFormatWith(opts ...FormatOption) Format {
+	opts = append([]FormatOption{WithColors(ColorEnabled(os.Stdout.Fd()))}, opts...)
+	c := newFormatConf(opts,
+		[]HeaderPart{HeaderLvl, HeaderTime, HeaderCaller, HeaderReqID, HeaderMsg},
+		func(l Lvl) string { return strings.ToUpper(l.String()) })
+	return FormatFunc(func(r *Record) []byte {
+		color := 0
+		if c.color {
+			color = lvlColor(r.Lvl)
+		}
+		var buf = make([]byte, 0, 256)
+		buf = c.appendHead(buf, r, color, true)
+		return c.appendCtx(buf, r.Ctx, color)
+	})
+}
+
+func newFormatConf(opts []FormatOption, header []HeaderPart, lvlName func(Lvl) string) *formatConf {
+	c := &formatConf{
+		timeLayout: timeFormat,
+		header:     header,
+		lvlName:    lvlName,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeLayout == "UNIX" {
+		// the encoder's name for it
+		c.timeLayout = ""
+	}
+	return c
+}
+
+// names returns the key names of r with the configured ones in place.
+func (c *formatConf) names(r *Record) RecordKeyNames {
+	names := r.KeyNames
+	if c.keyNames.Time != "" {
+		names.Time = c.keyNames.Time
+	}
+	if c.keyNames.Msg != "" {
+		names.Msg = c.keyNames.Msg
+	}
+	if c.keyNames.Lvl != "" {
+		names.Lvl = c.keyNames.Lvl
+	}
+	if c.keyNames.Call != "" {
+		names.Call = c.keyNames.Call
+	}
+	if c.keyNames.ReqID != "" {
+		names.ReqID = c.keyNames.ReqID
+	}
+	return names
+}
+
+// appendName appends "name=" if name isn't empty.
+func (c *formatConf) appendName(buf []byte, name string) []byte {
+	if name == "" {
+		return buf
+	}
+	buf = append(buf, name...)
+	return append(buf, '=')
+}
+
+func (c *formatConf) appendHead(buf []byte, r *Record, color int, term bool) []byte {
+	names := c.names(r)
+	caller := r.Call
+	if r.CustomCaller != "" {
+		caller = r.CustomCaller
+	}
+
+	first := true
+	for _, part := range c.header {
+		if (part == HeaderCaller && caller == "") || (part == HeaderReqID && r.RequestID == "") {
+			continue
+		}
+		if !first {
+			buf = append(buf, ' ')
+		}
+		first = false
+
+		switch part {
+		case HeaderTime:
+			buf = append(buf, '[')
+			buf = c.appendName(buf, c.keyNames.Time)
+			buf = enc.AppendTime(buf, r.Time, c.timeLayout)
+			buf = append(buf, ']')
+		case HeaderLvl:
+			if term {
+				buf = c.appendName(buf, c.keyNames.Lvl)
+				buf = appendColordString(buf, c.lvlName(r.Lvl), color)
+			} else {
+				buf = append(buf, '[')
+				buf = c.appendName(buf, c.keyNames.Lvl)
+				buf = append(buf, c.lvlName(r.Lvl)...)
+				buf = append(buf, ']')
+			}
+		case HeaderCaller:
+			buf = append(buf, '[')
+			buf = c.appendName(buf, c.keyNames.Call)
+			buf = append(buf, caller...)
+			buf = append(buf, ']')
+		case HeaderReqID:
+			buf = append(buf, '[')
+			buf = append(buf, names.ReqID...)
+			buf = append(buf, '=')
+			buf = append(buf, r.RequestID...)
+			buf = append(buf, ']')
+		case HeaderMsg:
+			buf = c.appendField(buf, names.Msg, r.Msg, color)
+		}
+	}
+	return buf
+}
+
+// appendCtx appends the context pairs each after a space, and a newline.
+func (c *formatConf) appendCtx(buf []byte, ctx []interface{}, color int) []byte {
+	if !c.strict {
+		return logfmt(buf, ctx, color)
+	}
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		v := ctx[i+1]
+		if !ok {
+			k, v = errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+		}
+		buf = append(buf, ' ')
+		buf = c.appendField(buf, k, v, color)
+	}
+	return append(buf, '\n')
+}
+
+func (c *formatConf) appendField(buf []byte, k string, v interface{}, color int) []byte {
+	if !c.strict {
+		buf = appendColordString(buf, k, color)
+		buf = append(buf, '=')
+		return appendVal(buf, v)
+	}
+	if color == 0 {
+		return lfenc.AppendField(buf, k, v)
+	}
+	// flattened values are one pair per leaf, color each of their keys
+	fields := lfenc.AppendField(nil, k, v)
+	for len(fields) > 0 {
+		eq := bytes.IndexByte(fields, '=')
+		buf = appendColordString(buf, string(fields[:eq]), color)
+		fields = fields[eq:]
+		end := nextPair(fields)
+		buf = append(buf, fields[:end]...)
+		fields = fields[end:]
+	}
+	return buf
+}
+
+// nextPair returns the length of the logfmt value at the start of b, which
+// starts with its '=', including the space after it if there is one.
+func nextPair(b []byte) int {
+	quoted := false
+	for i := 1; i < len(b); i++ {
+		switch {
+		case b[i] == '\\' && quoted:
+			i++
+		case b[i] == '"':
+			quoted = !quoted
+		case b[i] == ' ' && !quoted:
+			return i + 1
+		}
+	}
+	return len(b)
+}
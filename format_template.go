@@ -0,0 +1,347 @@
+package log15
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TemplateFormat returns a Format that lays records out after pattern,
+// a text with directives that are replaced by parts of the record:
+//
+//     %time{layout}  the time, in timeFormat or the given time.Format layout,
+//                    "UNIX", "UNIXMS" or "UNIXMICRO"
+//     %lvl{names}    the level: "dbug", or "DBUG" with {upper} and "DEBUG"
+//                    with {long}
+//     %caller{verb}  file:line of the logging call, or the Call formatted with
+//                    a fmt verb such as {%+n} or {%#v}
+//     %reqid         the request ID
+//     %msg           the message
+//     %ctx           the context as key=value pairs, or as plain logfmt with
+//                    {logfmt}
+//     %field{key}    the value of key in the context, empty if it's missing
+//     %meta          the meta key=value pair of a Meta record
+//     %color{name}   start a color: black, red, green, yellow, blue, magenta,
+//                    cyan, white or lvl for the color of the record's level
+//     %reset         end a color
+//     %n             a newline
+//     %%             a percent sign
+//
+// A directive may be given a width, like a fmt verb: %5lvl pads the level
+// with spaces on the left to 5 characters, %-5lvl on the right, and %.20caller
+// cuts the caller to its last 20 characters. Each record ends with a
+// newline, added if pattern doesn't end with one. A log4j-style layout:
+//
+//     log.TemplateFormat("%time{2006-01-02 15:04:05,000} %-5lvl{long} [%reqid] %caller - %msg %ctx")
+//
+// The pattern is parsed once, an error is returned if it is malformed.
+func TemplateFormat(pattern string) (Format, error) {
+	segs, newline, err := parseTemplate(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !newline {
+		segs = append(segs, literal("\n"))
+	}
+	return FormatFunc(func(r *Record) []byte {
+		var buf = make([]byte, 0, 256)
+		for _, seg := range segs {
+			buf = seg(buf, r)
+		}
+		return buf
+	}), nil
+}
+
+// TemplateFormat is like the TemplateFormat function but panics if the
+// pattern is malformed.
+func (m muster) TemplateFormat(pattern string) Format {
+	f, err := TemplateFormat(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// A segment appends a part of a record laid out by a template.
+type segment func(buf []byte, r *Record) []byte
+
+func literal(s string) segment {
+	return func(buf []byte, r *Record) []byte {
+		return append(buf, s...)
+	}
+}
+
+var templateColors = map[string]int{
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+}
+
+// parseTemplate compiles pattern into segments and reports whether it ends
+// with a newline.
+func parseTemplate(pattern string) ([]segment, bool, error) {
+	var (
+		segs    []segment
+		lit     []byte
+		newline bool
+	)
+	fail := func(format string, args ...interface{}) ([]segment, bool, error) {
+		return nil, false, fmt.Errorf("template %q: %s", pattern, fmt.Sprintf(format, args...))
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			lit = append(lit, pattern[i])
+			newline = pattern[i] == '\n'
+			continue
+		}
+		i++
+		if i == len(pattern) {
+			return fail("trailing %%")
+		}
+		if pattern[i] == '%' {
+			lit = append(lit, '%')
+			newline = false
+			continue
+		}
+
+		// %[-][width][.max]name[{arg}]
+		start := i - 1
+		left := false
+		if pattern[i] == '-' {
+			left = true
+			i++
+		}
+		var width int
+		width, i = templateNumber(pattern, i)
+		max := -1
+		if i < len(pattern) && pattern[i] == '.' {
+			max, i = templateNumber(pattern, i+1)
+		}
+		j := i
+		for j < len(pattern) && pattern[j] >= 'a' && pattern[j] <= 'z' {
+			j++
+		}
+		name := pattern[i:j]
+		i = j
+		var arg string
+		hasArg := false
+		if i < len(pattern) && pattern[i] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return fail("unclosed { after %s", pattern[start:i])
+			}
+			arg, hasArg = pattern[i+1:i+end], true
+			i += end
+		} else {
+			i--
+		}
+
+		var seg segment
+		switch name {
+		case "time":
+			layout := timeFormat
+			if hasArg {
+				layout = arg
+			}
+			if layout == "UNIX" {
+				layout = ""
+			}
+			seg = func(buf []byte, r *Record) []byte {
+				return enc.AppendTime(buf, r.Time, layout)
+			}
+		case "lvl":
+			var name func(Lvl) string
+			switch arg {
+			case "":
+				name = Lvl.String
+			case "upper":
+				name = func(l Lvl) string { return strings.ToUpper(l.String()) }
+			case "long":
+				name = Lvl.LongName
+			default:
+				return fail("unknown level names {%s}", arg)
+			}
+			seg = func(buf []byte, r *Record) []byte {
+				return append(buf, name(r.Lvl)...)
+			}
+		case "caller":
+			if arg == "" {
+				seg = func(buf []byte, r *Record) []byte {
+					if r.CustomCaller != "" {
+						return append(buf, r.CustomCaller...)
+					}
+					return append(buf, r.Call...)
+				}
+			} else {
+				format := arg
+				seg = func(buf []byte, r *Record) []byte {
+					if r.PC == 0 {
+						return append(buf, r.Call...)
+					}
+					return append(buf, fmt.Sprintf(format, r.Caller())...)
+				}
+			}
+		case "reqid":
+			seg = func(buf []byte, r *Record) []byte {
+				return append(buf, r.RequestID...)
+			}
+		case "msg":
+			seg = func(buf []byte, r *Record) []byte {
+				return append(buf, r.Msg...)
+			}
+		case "ctx":
+			strict := false
+			switch arg {
+			case "":
+			case "logfmt":
+				strict = true
+			default:
+				return fail("unknown context encoding {%s}", arg)
+			}
+			seg = func(buf []byte, r *Record) []byte {
+				return appendTemplateCtx(buf, r.Ctx, strict)
+			}
+		case "field":
+			if arg == "" {
+				return fail("%%field needs a key: %%field{key}")
+			}
+			key := arg
+			seg = func(buf []byte, r *Record) []byte {
+				for i := 0; i < len(r.Ctx)-1; i += 2 {
+					if k, ok := r.Ctx[i].(string); ok && k == key {
+						if s, ok := r.Ctx[i+1].(string); ok {
+							return append(buf, s...)
+						}
+						return appendVal(buf, r.Ctx[i+1])
+					}
+				}
+				return buf
+			}
+		case "meta":
+			seg = func(buf []byte, r *Record) []byte {
+				if r.MetaK == "" {
+					return buf
+				}
+				buf = append(buf, r.MetaK...)
+				buf = append(buf, '=')
+				return append(buf, r.MetaV...)
+			}
+		case "color":
+			if arg == "lvl" {
+				seg = func(buf []byte, r *Record) []byte {
+					return appendColorStart(buf, lvlColor(r.Lvl))
+				}
+				break
+			}
+			color, ok := templateColors[arg]
+			if !ok {
+				return fail("unknown color {%s}", arg)
+			}
+			seg = func(buf []byte, r *Record) []byte {
+				return appendColorStart(buf, color)
+			}
+		case "reset":
+			seg = literal("\x1b[0m")
+		case "n":
+			seg = literal("\n")
+		case "":
+			return fail("missing directive name after %s", pattern[start:i+1])
+		default:
+			return fail("unknown directive %%%s", name)
+		}
+
+		if width > 0 || max >= 0 {
+			seg = padded(seg, left, width, max)
+		}
+		if len(lit) > 0 {
+			segs = append(segs, literal(string(lit)))
+			lit = lit[:0]
+		}
+		segs = append(segs, seg)
+		newline = name == "n" && max != 0
+	}
+
+	if len(lit) > 0 {
+		segs = append(segs, literal(string(lit)))
+	}
+	return segs, newline, nil
+}
+
+// templateNumber parses the decimal number at s[i:], 0 if there is none,
+// and returns it with the index after it.
+func templateNumber(s string, i int) (int, int) {
+	j := i
+	for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+		j++
+	}
+	n, _ := strconv.Atoi(s[i:j])
+	return n, j
+}
+
+// padded cuts what seg appends to its last max characters, if max isn't
+// negative, and pads it with spaces to width characters, on the right if
+// left is true.
+func padded(seg segment, left bool, width, max int) segment {
+	return func(buf []byte, r *Record) []byte {
+		start := len(buf)
+		buf = seg(buf, r)
+		n := utf8.RuneCount(buf[start:])
+		if max >= 0 && n > max {
+			cut := start
+			for ; n > max; n-- {
+				_, size := utf8.DecodeRune(buf[cut:])
+				cut += size
+			}
+			buf = append(buf[:start], buf[cut:]...)
+		}
+		if n >= width {
+			return buf
+		}
+		pad := strings.Repeat(" ", width-n)
+		if left {
+			return append(buf, pad...)
+		}
+		buf = append(buf, pad...)
+		copy(buf[start+len(pad):], buf[start:len(buf)-len(pad)])
+		copy(buf[start:], pad)
+		return buf
+	}
+}
+
+func appendColorStart(buf []byte, color int) []byte {
+	if color == 0 {
+		return buf
+	}
+	buf = append(buf, "\x1b["...)
+	buf = enc.AppendInt(buf, color)
+	return append(buf, 'm')
+}
+
+// appendTemplateCtx appends the context pairs separated by spaces.
+func appendTemplateCtx(buf []byte, ctx []interface{}, strict bool) []byte {
+	for i := 0; i < len(ctx); i += 2 {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		k, ok := ctx[i].(string)
+		v := ctx[i+1]
+		if !ok {
+			k, v = errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+		}
+		if strict {
+			buf = lfenc.AppendField(buf, k, v)
+		} else {
+			buf = append(buf, k...)
+			buf = append(buf, '=')
+			buf = appendVal(buf, v)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,231 @@
+package log15
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuexihuang/new_log15/term"
+)
+
+const (
+	termKeyColor = 36 // cyan
+	termErrColor = 31 // red
+)
+
+// ColorEnabled reports whether output to the file descriptor fd should be
+// colored: not if the NO_COLOR environment variable is set, always if
+// FORCE_COLOR is set to anything but "0" or "false", and otherwise if fd is
+// a terminal. See https://no-color.org.
+func ColorEnabled(fd uintptr) bool {
+	if noColor() {
+		return false
+	}
+	if force := os.Getenv("FORCE_COLOR"); force != "" {
+		return force != "0" && force != "false"
+	}
+	return term.IsTty(fd)
+}
+
+// noColor reports whether the NO_COLOR environment variable turns colors
+// off.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// defaultTermFormat returns the format of the default handler writing to
+// fd: TerminalFormat if fd is a terminal or colors are forced with
+// FORCE_COLOR, colored as ColorEnabled says, and nil otherwise.
+func defaultTermFormat(fd uintptr) Format {
+	color := ColorEnabled(fd)
+	if !color && !term.IsTty(fd) {
+		return nil
+	}
+	return terminalFormat(color)
+}
+
+// A TermOption configures a PrettyTerminalFormat.
+type TermOption func(c *termConf)
+
+type termConf struct {
+	color     bool
+	ctxColumn int
+	multiline int
+}
+
+// WithColor sets whether the format writes colors. It does by default;
+// pass ColorEnabled(f.Fd()) to follow the terminal and the environment.
+func WithColor(color bool) TermOption {
+	return func(c *termConf) {
+		c.color = color
+	}
+}
+
+// WithContextColumn sets the column, counted from the start of the line,
+// the message is padded to, so that the context of consecutive records
+// starts in the same column whatever the length of their callers. It is 80
+// by default, 0 turns padding off.
+func WithContextColumn(n int) TermOption {
+	return func(c *termConf) {
+		c.ctxColumn = n
+	}
+}
+
+// WithMultiline writes values longer than n characters, and values
+// spanning several lines like stack traces, below the record, one line
+// each, rather than in between the other pairs. It is off by default.
+func WithMultiline(n int) TermOption {
+	return func(c *termConf) {
+		c.multiline = n
+	}
+}
+
+// PrettyTerminalFormat formats log records for reading on a terminal, like
+// TerminalFormat, but aligns the context of consecutive records after the
+// message, colors keys and values differently, marks errors in red and
+// only quotes values where needed:
+//
+//     INFO [10-16|14:02:03] [main.go:12] user login                               user=bob n=3
+//     EROR [10-16|14:02:04] [db.go:40] query failed                               err="connection refused"
+//
+// The level keeps the color of TerminalFormat. Errors are the values of
+// the "err" and "error" keys, and values implementing error.
+func PrettyTerminalFormat(opts ...TermOption) Format {
+	c := &termConf{
+		color:     true,
+		ctxColumn: termCtxColumn,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return FormatFunc(func(r *Record) []byte {
+		color, keyColor, errColor := lvlColor(r.Lvl), termKeyColor, termErrColor
+		if !c.color {
+			color, keyColor, errColor = 0, 0, 0
+		}
+
+		var buf = make([]byte, 0, 256)
+
+		// head
+		buf = appendColordString(buf, strings.ToUpper(r.Lvl.String()), color)
+		buf = append(buf, " ["...)
+		buf = enc.AppendTime(buf, r.Time, termTimeFormat)
+		buf = append(buf, ']')
+		caller := r.Call
+		if r.CustomCaller != "" {
+			caller = r.CustomCaller
+		}
+		if caller != "" {
+			buf = append(buf, " ["...)
+			buf = append(buf, caller...)
+			buf = append(buf, ']')
+		}
+		if r.RequestID != "" {
+			buf = append(buf, " ["...)
+			buf = append(buf, r.KeyNames.ReqID...)
+			buf = append(buf, '=')
+			buf = append(buf, r.RequestID...)
+			buf = append(buf, ']')
+		}
+
+		// msg, padded if a context follows
+		buf = append(buf, ' ')
+		buf = append(buf, r.Msg...)
+		if n := visibleWidth(buf); len(r.Ctx) > 0 && n < c.ctxColumn {
+			buf = append(buf, strings.Repeat(" ", c.ctxColumn-n)...)
+		}
+
+		// fields, the long ones last
+		var long []int
+		for i := 0; i < len(r.Ctx); i += 2 {
+			k, v := termPair(r.Ctx, i)
+			val, quote := termValue(v)
+			if c.multiline > 0 && (utf8.RuneCountInString(val) > c.multiline || strings.IndexByte(val, '\n') >= 0) {
+				long = append(long, i)
+				continue
+			}
+
+			if quote {
+				val = string(lfenc.AppendString(nil, val))
+			}
+			buf = append(buf, ' ')
+			if isErrorPair(k, v) {
+				buf = appendColordString(buf, k, errColor)
+				buf = append(buf, '=')
+				buf = appendColordString(buf, val, errColor)
+			} else {
+				buf = appendColordString(buf, k, keyColor)
+				buf = append(buf, '=')
+				buf = append(buf, val...)
+			}
+		}
+		buf = append(buf, '\n')
+
+		for _, i := range long {
+			k, v := termPair(r.Ctx, i)
+			color := keyColor
+			if isErrorPair(k, v) {
+				color = errColor
+			}
+			buf = append(buf, "    "...)
+			buf = appendColordString(buf, k, color)
+			buf = append(buf, ":\n"...)
+			val, _ := termValue(v)
+			for _, line := range strings.Split(strings.TrimRight(val, "\n"), "\n") {
+				buf = append(buf, "        "...)
+				buf = append(buf, line...)
+				buf = append(buf, '\n')
+			}
+		}
+
+		return buf
+	})
+}
+
+// visibleWidth returns the number of characters of b shown on a terminal,
+// leaving out color escape sequences.
+func visibleWidth(b []byte) int {
+	n := 0
+	for i := 0; i < len(b); {
+		if b[i] == '\x1b' {
+			for i < len(b) && b[i] != 'm' {
+				i++
+			}
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRune(b[i:])
+		i += size
+		n++
+	}
+	return n
+}
+
+// termPair returns the key and value of the context pair at ctx[i].
+func termPair(ctx []interface{}, i int) (string, interface{}) {
+	k, ok := ctx[i].(string)
+	if !ok {
+		return errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+	}
+	return k, ctx[i+1]
+}
+
+// isErrorPair reports whether a context pair is highlighted as an error.
+func isErrorPair(k string, v interface{}) bool {
+	if _, ok := v.(error); ok {
+		return true
+	}
+	return k == "err" || k == "error" || k == errorKey
+}
+
+// termValue returns the text of a context value as PrettyTerminalFormat
+// writes it, and whether it is to be quoted where needed. Maps, structs
+// and slices are written as JSON, unquoted.
+func termValue(v interface{}) (string, bool) {
+	if s, ok := lfenc.Text(v); ok {
+		return s, true
+	}
+	return formatLogfmtValue(v), false
+}
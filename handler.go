@@ -10,12 +10,7 @@ import (
 	"sync"
 
 	"bytes"
-	"encoding/binary"
-	"encoding/json"
 	"errors"
-	"sync/atomic"
-
-	"gopkg.in/natefinch/lumberjack.v2" // --[stevenmi]
 )
 
 // A Logger prints its log records by writing to a Handler.
@@ -38,6 +33,72 @@ func (h funcHandler) Log(r *Record) error {
 	return h(r)
 }
 
+// A Flusher is a Handler which can write out any records it has buffered
+// on demand. Handlers in this package which wrap other handlers forward
+// Flush to them.
+type Flusher interface {
+	Flush() error
+}
+
+// A Closer is a Handler which holds resources, like files, sockets or
+// goroutines, that should be released once it is no longer used. Handlers
+// in this package which wrap other handlers forward Close to them.
+type Closer interface {
+	Close() error
+}
+
+// Flush flushes h if it implements Flusher and does nothing otherwise.
+func Flush(h Handler) error {
+	if f, ok := h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close closes h if it implements Closer and does nothing otherwise.
+// Close does not flush h first, see Shutdown.
+func Close(h Handler) error {
+	if c, ok := h.(Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// parentHandler is a FuncHandler that forwards Flush and Close to the
+// handlers it wraps.
+type parentHandler struct {
+	fn funcHandler
+	hs []Handler
+}
+
+func wrapHandler(fn func(r *Record) error, hs ...Handler) Handler {
+	return &parentHandler{fn, hs}
+}
+
+func (h *parentHandler) Log(r *Record) error {
+	return h.fn(r)
+}
+
+func (h *parentHandler) Flush() error {
+	var err error
+	for _, child := range h.hs {
+		if e := Flush(child); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (h *parentHandler) Close() error {
+	var err error
+	for _, child := range h.hs {
+		if e := Close(child); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // StreamHandler writes log records to an io.Writer
 // with the given format. StreamHandler can be used
 // to easily begin writing log records to other
@@ -45,23 +106,42 @@ func (h funcHandler) Log(r *Record) error {
 //
 // StreamHandler wraps itself with LazyHandler and SyncHandler
 // to evaluate Lazy objects and perform safe concurrent writes.
+//
+// If wr has a Flush() error method, like a *bufio.Writer, it is called
+// when the handler is flushed. StreamHandler never closes wr.
 func StreamHandler(wr io.Writer, fmtr Format) Handler {
-	h := FuncHandler(func(r *Record) error {
+	h := &streamHandler{wr, func(r *Record) error {
 		_, err := wr.Write(fmtr.Format(r))
 		return err
-	})
+	}}
 	return LazyHandler(SyncHandler(h))
 }
 
+type streamHandler struct {
+	wr io.Writer
+	fn funcHandler
+}
+
+func (h *streamHandler) Log(r *Record) error {
+	return h.fn(r)
+}
+
+func (h *streamHandler) Flush() error {
+	if f, ok := h.wr.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 // Same as StreamHandler() except filting the baseMonitor Meta meaasage
 func SelfStreamHandler(wr io.Writer, fmtr Format) Handler { // -- stevenmi 2019-0703
-	h := FuncHandler(func(r *Record) error {
+	h := &streamHandler{wr, func(r *Record) error {
 		if r.MetaK == BaseMonitor.String() {
 			return nil
 		}
 		_, err := wr.Write(fmtr.Format(r))
 		return err
-	})
+	}}
 	return LazyHandler(SyncHandler(h))
 }
 
@@ -69,12 +149,30 @@ func SelfStreamHandler(wr io.Writer, fmtr Format) Handler { // -- stevenmi 2019-
 // only a single Log operation can proceed at a time. It's necessary
 // for thread-safe concurrent writes.
 func SyncHandler(h Handler) Handler {
-	var mu sync.Mutex
-	return FuncHandler(func(r *Record) error {
-		defer mu.Unlock()
-		mu.Lock()
-		return h.Log(r)
-	})
+	return &syncHandler{h: h}
+}
+
+type syncHandler struct {
+	mu sync.Mutex
+	h  Handler
+}
+
+func (h *syncHandler) Log(r *Record) error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return h.h.Log(r)
+}
+
+func (h *syncHandler) Flush() error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return Flush(h.h)
+}
+
+func (h *syncHandler) Close() error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return Close(h.h)
 }
 
 // FileHandler returns a handler which writes log records to the give file
@@ -87,294 +185,126 @@ func FileHandler(path string, fmtr Format) (Handler, error) {
 	if err != nil {
 		return nil, err
 	}
-	return closingHandler{f, StreamHandler(f, fmtr)}, nil
+	return &closingHandler{f, StreamHandler(f, fmtr)}, nil
 }
 */
 
 // storage rotate file paraments --[stevenmi]
 type rotate_conf struct {
-	MaxSize        int // megabytes
-	MaxAge         int
-	MaxBackup      int //days
-	Compress       bool
-	IO_WriteCloser *lumberjack.Logger
-}
-
-func (r *rotate_conf) SetLoggerWriteCloser(f *lumberjack.Logger) {
-	r.IO_WriteCloser = f
-}
-
-func (r *rotate_conf) GetLoggerWriteCloser() *lumberjack.Logger {
-	return r.IO_WriteCloser
+	MaxSize   int // megabytes
+	MaxAge    int
+	MaxBackup int //days
+	Compress  bool
 }
 
 func (r *rotate_conf) SetRotatePara(maxsize, maxage, maxbackup int, compress bool) {
 	r.MaxSize, r.MaxAge, r.MaxBackup, r.Compress = maxsize, maxage, maxbackup, compress
 }
 
-var rotateConf = &rotate_conf{100, 10, 30, true, nil} // default: 100M, 10day, 30 file, compress
-
-func LogRotate() {
-	if rotateConf.IO_WriteCloser != nil {
-		rotateConf.GetLoggerWriteCloser().Rotate()
-	}
-}
+var rotateConf = &rotate_conf{100, 10, 30, true} // default: 100M, 10day, 30 file, compress
 
+// SetRotatePara sets the default rotation settings of file handlers
+// created afterwards, a maxsize of 0 turns rotation by size off. Use
+// FileOptions to configure a single handler.
 func SetRotatePara(maxsize, maxage, maxbackup int, compress bool) {
 	rotateConf.SetRotatePara(maxsize, maxage, maxbackup, compress)
 }
 
-func FileHandler(path string, fmtr Format) (Handler, error) {
-	f := &lumberjack.Logger{
-		Filename:   path,
-		MaxSize:    rotateConf.MaxSize, // megabytes
-		MaxBackups: rotateConf.MaxBackup,
-		MaxAge:     rotateConf.MaxAge, // days
-		Compress:   rotateConf.Compress,
-		LocalTime:  true,
-	}
-
-	rotateConf.SetLoggerWriteCloser(f)
-
-	//f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	//if err != nil {
-	//	return nil, err
-	//}
-	return closingHandler{f, StreamHandler(f, fmtr)}, nil
-}
-
-var udpBufferPool *sync.Pool
-
-type UDPLogger struct {
-	logAgentAddr string
-	who          string
-	conn         net.Conn
-	count        uint32
-	WriteBuf     []byte
-}
-
-func (u *UDPLogger) init() (err error) {
-	udpBufferPool = &sync.Pool{
-		New: func() interface{} { return new(bytes.Buffer) },
-	}
-
-	u.conn, _ = net.Dial("udp", u.logAgentAddr)
-	u.sayHello()
-
-	//go func() {
-	//	for {
-	//		var buf [1024]byte
-	//		u.conn.(*net.UDPConn).ReadFromUDP(buf[0:])
-	//		if buf[0] == 0xEF && buf[1] == 0xEE {
-	//			//fmt.Println(string(buf[2:]))
-	//		}
-	//	}
-	//}()
-	//
-	//go func() {
-	//	timeout := time.Tick(5*time.Second)
-	//	for {
-	//		select{
-	//		case <- timeout:
-	//			u.sayHello()
-	//		}
-	//	}
-	//}()
-	return
-}
-
-const (
-	MagicNum = 0xEEEF
-	Version  = 2
-)
-
-type MsgType uint8
-
-const (
-	Hello_Packet MsgType = iota
-	Data_Packet
-)
-
-type HelloPacket struct {
-	ServiceName string `json:"serviceName"`
-}
-
-func (u *UDPLogger) sayHello() {
-	body := HelloPacket{
-		ServiceName: u.who,
-	}
-	bodyBuf, _ := json.Marshal(&body)
-
-	e := udpBufferPool.Get().(*bytes.Buffer)
-	binary.Write(e, binary.BigEndian, uint16(MagicNum))
-	binary.Write(e, binary.BigEndian, uint8(Version))
-	binary.Write(e, binary.BigEndian, uint8(Hello_Packet))
-	binary.Write(e, binary.BigEndian, uint16(len(bodyBuf)))
-
-	e.Write(bodyBuf)
-	u.conn.Write(e.Bytes())
-
-	e.Reset()
-	udpBufferPool.Put(e)
-}
-
-func (u *UDPLogger) Write(p []byte) (n int, err error) {
-	if atomic.AddUint32(&u.count, 1) >= 100 {
-		atomic.StoreUint32(&u.count, 0)
-		u.sayHello()
-	}
-
-	e := udpBufferPool.Get().(*bytes.Buffer)
-	binary.Write(e, binary.BigEndian, uint16(MagicNum))
-	binary.Write(e, binary.BigEndian, uint8(Version))
-	binary.Write(e, binary.BigEndian, uint8(Data_Packet))
-	binary.Write(e, binary.BigEndian, logLevel)
-	if logMetaKey == "" && logMetaValue == "" {
-		binary.Write(e, binary.BigEndian, uint16(0))
-	} else {
-		m := make(map[string]string)
-		m[logMetaKey] = logMetaValue
-		metaBuf, err := json.Marshal(m)
-		if err == nil {
-			binary.Write(e, binary.BigEndian, uint16(len(metaBuf)))
-			e.Write(metaBuf)
-		} else {
-			binary.Write(e, binary.BigEndian, uint16(0))
-		}
-	}
-	e.Write(p)
-
-	b := e.Bytes()
-	length := e.Len()
-
-	var cursor = 0
-	for {
-		if length > cursor+1024 {
-			u.conn.Write(b[cursor : cursor+1024])
-			cursor = cursor + 1024
-		} else {
-			u.conn.Write(b[cursor:])
-			break
-		}
-	}
-
-	logMetaKey = ""
-	logMetaValue = ""
-
-	e.Reset()
-	udpBufferPool.Put(e)
-
-	return length, nil //local ip, will not err
-}
-
-func (u *UDPLogger) Close() error {
-	return u.conn.Close()
-}
-
-type Option func(u *UDPLogger)
-
-func WithDstAddr(dstAddr string) Option {
-	return func(u *UDPLogger) {
-		u.logAgentAddr = dstAddr
-	}
-}
-
-func NetFileHandler(path, serviceName string, fmtr Format, opts ...Option) (Handler, error) {
-	if serviceName == "" {
-		return nil, errors.New("serviceName illegal")
-	}
-	u := &UDPLogger{
-		who: serviceName,
-	}
-
-	for _, opt := range opts {
-		opt(u)
-	}
-
-	if u.logAgentAddr == "" {
-		u.logAgentAddr = "127.0.0.1:9999" //default
-	}
-
-	u.init()
-
-	//if needLocalLog {
-	f := &lumberjack.Logger{
-		Filename:   path,
-		MaxSize:    rotateConf.MaxSize, // megabytes
-		MaxBackups: rotateConf.MaxBackup,
-		MaxAge:     rotateConf.MaxAge, // days
-		Compress:   rotateConf.Compress,
-		LocalTime:  true,
+// FileHandler writes to a file which is rotated according to the defaults
+// of SetRotatePara, overridden by the given options:
+//
+//     log.FileHandler("/var/log/access.log", log.LogfmtFormat(),
+//         log.WithMaxSize(500), log.WithMaxBackups(10), log.WithFileMode(0640))
+//
+// Every file handler can be rotated with LogRotate or RotateFile.
+func FileHandler(path string, fmtr Format, opts ...FileOption) (Handler, error) {
+	f, err := openLogFile(path, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	rotateConf.SetLoggerWriteCloser(f)
-
-	// filte baseMonitor Meta Meassge in SelfStreamHandler()
-	return closingHandler{f, MultiHandler(SelfStreamHandler(f, fmtr), StreamHandler(u, fmtr))}, nil
-
-	//return closingHandler{f, MultiHandler(StreamHandler(f, fmtr), StreamHandler(u, fmtr))}, nil
-	//} else {
-	//      return closingHandler{u, StreamHandler(u, fmtr)}, nil
-	//}
+	return &closingHandler{f, StreamHandler(f, fmtr)}, nil
 }
 
 // NetHandler opens a socket to the given address and writes records
-// over the connection.
+// over the connection. Once the peer goes away every write fails; use
+// ReconnectingNetHandler to survive peer restarts.
 func NetHandler(network, addr string, fmtr Format) (Handler, error) {
 	conn, err := net.Dial(network, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return closingHandler{conn, StreamHandler(conn, fmtr)}, nil
+	return &closingHandler{conn, StreamHandler(conn, fmtr)}, nil
 }
 
-// XXX: closingHandler is essentially unused at the moment
-// it's meant for a future time when the Handler interface supports
-// a possible Close() operation
+// closingHandler owns the io.WriteCloser its Handler writes to.
+// Closing it closes the Handler first and then the writer.
 type closingHandler struct {
 	io.WriteCloser
 	Handler
 }
 
+func (h *closingHandler) Flush() error {
+	return Flush(h.Handler)
+}
+
 func (h *closingHandler) Close() error {
-	return h.WriteCloser.Close()
+	err := Close(h.Handler)
+	if cerr := h.WriteCloser.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 // CallerFileHandler returns a Handler that adds the line number and file of
 // the calling function to the context with key "caller".
 func CallerFileHandler(h Handler) Handler {
-	return FuncHandler(func(r *Record) error {
+	return wrapHandler(func(r *Record) error {
 		//r.Ctx = append(r.Ctx, "caller", fmt.Sprint(r.Call))
 		r.Ctx = append(r.Ctx, "caller", r.Call)
 		return h.Log(r)
-	})
+	}, h)
 }
 
 // CallerFuncHandler returns a Handler that adds the calling function name to
 // the context with key "fn".
 func CallerFuncHandler(h Handler) Handler {
-	return FuncHandler(func(r *Record) error {
-		//r.Ctx = append(r.Ctx, "fn", fmt.Sprintf("%+n", r.Call))
-		r.Ctx = append(r.Ctx, "fn", r.Call)
+	return wrapHandler(func(r *Record) error {
+		if r.PC != 0 {
+			r.Ctx = append(r.Ctx, "fn", fmt.Sprintf("%+n", r.Caller()))
+		}
 		return h.Log(r)
-	})
+	}, h)
+}
+
+// CallerFormatHandler returns a Handler that adds the calling function,
+// formatted according to format, to the context with key "caller". See
+// Call for the supported formats; "%#v" for instance tells apart files of
+// the same name in different packages: caller=internal/db/handler.go:42.
+func CallerFormatHandler(format string, h Handler) Handler {
+	return wrapHandler(func(r *Record) error {
+		if r.PC != 0 {
+			r.Ctx = append(r.Ctx, "caller", fmt.Sprintf(format, r.Caller()))
+		}
+		return h.Log(r)
+	}, h)
 }
 
 // CallerStackHandler returns a Handler that adds a stack trace to the context
 // with key "stack". The stack trace is formated as a space separated list of
 // call sites inside matching []'s. The most recent call site is listed first.
-// Each call site is formatted according to format. See the documentation of
-// package github.com/go-stack/stack for the list of supported formats.
-//func CallerStackHandler(format string, h Handler) Handler {
-//	return FuncHandler(func(r *Record) error {
-//		// s := stack.Trace().TrimBelow(r.Call).TrimRuntime()
-//		if len(r.Call) > 0 {
-//			r.Ctx = append(r.Ctx, "stack", r.Call)
-//		}
-//		return h.Log(r)
-//	})
-//}
+// Each call site is formatted according to format, see Call for the list of
+// supported formats. Only records at or above minLvl which carry a stack get
+// one; stacks are captured for LvlError and above unless changed with
+// SetStackCaptureLevel.
+func CallerStackHandler(minLvl Lvl, format string, h Handler) Handler {
+	return wrapHandler(func(r *Record) error {
+		if r.Lvl <= minLvl && len(r.Stack) > 0 {
+			r.Ctx = append(r.Ctx, "stack", fmt.Sprintf(format, r.CallStack()))
+		}
+		return h.Log(r)
+	}, h)
+}
 
 // FilterHandler returns a Handler that only writes records to the
 // wrapped Handler if the given function evaluates true. For example,
@@ -390,12 +320,12 @@ func CallerFuncHandler(h Handler) Handler {
 //    }, h))
 //
 func FilterHandler(fn func(r *Record) bool, h Handler) Handler {
-	return FuncHandler(func(r *Record) error {
+	return wrapHandler(func(r *Record) error {
 		if fn(r) {
 			return h.Log(r)
 		}
 		return nil
-	})
+	}, h)
 }
 
 // MatchFilterHandler returns a Handler that only writes records
@@ -447,14 +377,170 @@ func LvlFilterHandler(maxLvl Lvl, h Handler) Handler {
 //         log.Must.FileHandler("/var/log/app.log", log.LogfmtFormat()),
 //         log.StderrHandler)
 //
+// Every handler is written to even if an earlier one fails. If any of them
+// fails, a MultiError is returned which lists each failed handler by index
+// and by name, if it was wrapped with NamedHandler. See MultiHandlerWith for
+// reporting failures elsewhere and for writing to the handlers in parallel.
 func MultiHandler(hs ...Handler) Handler {
-	return FuncHandler(func(r *Record) error {
-		for _, h := range hs {
-			// what to do about failures?
-			h.Log(r)
+	return MultiHandlerWith(hs)
+}
+
+// A MultiOption configures a handler returned by MultiHandlerWith.
+type MultiOption func(m *multiHandler)
+
+// WithMultiErrorCallback makes the handler report each failed write to fn
+// instead of returning an error, so a broken sink does not make the whole
+// MultiHandler look failed to a FailoverHandler above it. fn receives a
+// *HandlerError and may be called concurrently when writing in parallel.
+func WithMultiErrorCallback(fn func(r *Record, err error)) MultiOption {
+	return func(m *multiHandler) {
+		m.onErr = fn
+	}
+}
+
+// WithParallel makes the handler write to all of its handlers concurrently
+// and wait for them, so one slow sink doesn't delay the others. Each handler
+// gets its own copy of the record, since handlers may modify its context.
+func WithParallel() MultiOption {
+	return func(m *multiHandler) {
+		m.parallel = true
+	}
+}
+
+// WriteErrorsTo returns an error callback, for WithMultiErrorCallback or
+// WithErrorCallback, which prints a line for every failed write to w,
+// typically os.Stderr.
+func WriteErrorsTo(w io.Writer) func(r *Record, err error) {
+	var mu sync.Mutex
+	return func(r *Record, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "log15: failed to write record %q: %v\n", r.Msg, err)
+	}
+}
+
+// MultiHandlerWith is MultiHandler with options.
+func MultiHandlerWith(hs []Handler, opts ...MultiOption) Handler {
+	m := &multiHandler{hs: hs}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return wrapHandler(m.log, hs...)
+}
+
+type multiHandler struct {
+	hs       []Handler
+	onErr    func(r *Record, err error)
+	parallel bool
+}
+
+func (m *multiHandler) log(r *Record) error {
+	var errs MultiError
+	if m.parallel {
+		results := make([]error, len(m.hs))
+		var wg sync.WaitGroup
+		wg.Add(len(m.hs))
+		for i, h := range m.hs {
+			go func(i int, h Handler, r *Record) {
+				defer wg.Done()
+				results[i] = m.report(i, h, r, h.Log(r))
+			}(i, h, r.copy())
+		}
+		wg.Wait()
+		for _, err := range results {
+			if err != nil {
+				errs = append(errs, err.(*HandlerError))
+			}
+		}
+	} else {
+		for i, h := range m.hs {
+			if err := m.report(i, h, r, h.Log(r)); err != nil {
+				errs = append(errs, err.(*HandlerError))
+			}
 		}
+	}
+
+	if len(errs) == 0 {
 		return nil
-	})
+	}
+	return errs
+}
+
+// report hands a failed write to the error callback, or returns it as a
+// *HandlerError if there is none.
+func (m *multiHandler) report(i int, h Handler, r *Record, err error) error {
+	if err == nil {
+		return nil
+	}
+	herr := &HandlerError{Index: i, Name: handlerName(h), Err: err}
+	if m.onErr != nil {
+		m.onErr(r, herr)
+		return nil
+	}
+	return herr
+}
+
+// HandlerError describes the failure of one handler of a MultiHandler.
+type HandlerError struct {
+	Index int    // position of the handler in the MultiHandler's arguments
+	Name  string // name given with NamedHandler, if any
+	Err   error
+}
+
+func (e *HandlerError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("handler %d (%s): %v", e.Index, e.Name, e.Err)
+	}
+	return fmt.Sprintf("handler %d: %v", e.Index, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError is returned by a MultiHandler when any of its handlers fail.
+type MultiError []*HandlerError
+
+func (m MultiError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("log15: ")
+	for i, err := range m {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
+
+// NamedHandler attaches a name to h which is used to identify it in the
+// errors of a MultiHandler, e.g. NamedHandler("access-file", h).
+func NamedHandler(name string, h Handler) Handler {
+	return &namedHandler{name, h}
+}
+
+type namedHandler struct {
+	name string
+	Handler
+}
+
+func (h *namedHandler) Name() string {
+	return h.name
+}
+
+func (h *namedHandler) Flush() error {
+	return Flush(h.Handler)
+}
+
+func (h *namedHandler) Close() error {
+	return Close(h.Handler)
+}
+
+func handlerName(h Handler) string {
+	if n, ok := h.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return ""
 }
 
 // A FailoverHandler writes all log records to the first handler
@@ -473,7 +559,7 @@ func MultiHandler(hs ...Handler) Handler {
 // the form "failover_err_{idx}" which explain the error encountered while
 // trying to write to the handlers before them in the list.
 func FailoverHandler(hs ...Handler) Handler {
-	return FuncHandler(func(r *Record) error {
+	return wrapHandler(func(r *Record) error {
 		var err error
 		for i, h := range hs {
 			err = h.Log(r)
@@ -485,7 +571,7 @@ func FailoverHandler(hs ...Handler) Handler {
 		}
 
 		return err
-	})
+	}, hs...)
 }
 
 // ChannelHandler writes all records to the given channel.
@@ -503,14 +589,85 @@ func ChannelHandler(recs chan<- *Record) Handler {
 // handler whenever it is available for writing. Since these
 // writes happen asynchronously, all writes to a BufferedHandler
 // never return an error and any errors from the wrapped handler are ignored.
+// See AsyncHandler for a variant that can drop records instead of blocking.
+//
+// Flush waits until every record logged so far has been passed to the
+// wrapped handler and then flushes it. Close drains the channel, closes the
+// wrapped handler, and makes any later write fail.
 func BufferedHandler(bufSize int, h Handler) Handler {
-	recs := make(chan *Record, bufSize)
+	b := &bufferedHandler{
+		recs: make(chan bufferedItem, bufSize),
+		done: make(chan struct{}),
+		h:    h,
+	}
 	go func() {
-		for m := range recs {
-			_ = h.Log(m)
+		for it := range b.recs {
+			if it.flushed != nil {
+				close(it.flushed)
+				continue
+			}
+			_ = h.Log(it.r)
 		}
+		close(b.done)
 	}()
-	return ChannelHandler(recs)
+	return b
+}
+
+var errHandlerClosed = errors.New("log15: handler is closed")
+
+// A bufferedItem is a record to write, or a flush marker which the writer
+// goroutine acknowledges by closing flushed once the records queued before
+// it have been written.
+type bufferedItem struct {
+	r       *Record
+	flushed chan struct{}
+}
+
+type bufferedHandler struct {
+	mu     sync.RWMutex // guards closed against sends on recs
+	closed bool
+	recs   chan bufferedItem
+	done   chan struct{}
+	h      Handler
+}
+
+func (b *bufferedHandler) Log(r *Record) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return errHandlerClosed
+	}
+	b.recs <- bufferedItem{r: r}
+	return nil
+}
+
+func (b *bufferedHandler) Flush() error {
+	b.mu.RLock()
+	if b.closed {
+		// Close has drained the queue already
+		b.mu.RUnlock()
+		return Flush(b.h)
+	}
+	flushed := make(chan struct{})
+	b.recs <- bufferedItem{flushed: flushed}
+	b.mu.RUnlock()
+
+	<-flushed
+	return Flush(b.h)
+}
+
+func (b *bufferedHandler) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.recs)
+	b.mu.Unlock()
+
+	<-b.done
+	return Close(b.h)
 }
 
 // LazyHandler writes all values to the wrapped handler after evaluating
@@ -518,7 +675,7 @@ func BufferedHandler(bufSize int, h Handler) Handler {
 // around StreamHandler and SyslogHandler in this library, you'll only need
 // it if you write your own Handler.
 func LazyHandler(h Handler) Handler {
-	return FuncHandler(func(r *Record) error {
+	return wrapHandler(func(r *Record) error {
 		// go through the values (odd indices) and reassign
 		// the values of any lazy fn to the result of its execution
 		hadErr := false
@@ -530,9 +687,6 @@ func LazyHandler(h Handler) Handler {
 					hadErr = true
 					r.Ctx[i] = err
 				} else {
-					// if cs, ok := v.(stack.CallStack); ok {
-					// 	v = cs.TrimBelow(r.Call).TrimRuntime()
-					// }
 					r.Ctx[i] = v
 				}
 			}
@@ -543,7 +697,7 @@ func LazyHandler(h Handler) Handler {
 		}
 
 		return h.Log(r)
-	})
+	}, h)
 }
 
 func evaluateLazy(lz Lazy) (interface{}, error) {
@@ -585,7 +739,8 @@ func DiscardHandler() Handler {
 
 // The Must object provides the following Handler creation functions
 // which instead of returning an error parameter only return a Handler
-// and panic on failure: FileHandler, NetHandler, SyslogHandler, SyslogNetHandler
+// and panic on failure: FileHandler, NetHandler, SyslogHandler, SyslogNetHandler.
+// Must.TemplateFormat likewise returns a Format.
 var Must muster
 
 func must(h Handler, err error) Handler {
@@ -597,8 +752,8 @@ func must(h Handler, err error) Handler {
 
 type muster struct{}
 
-func (m muster) FileHandler(path string, fmtr Format) Handler {
-	return must(FileHandler(path, fmtr))
+func (m muster) FileHandler(path string, fmtr Format, opts ...FileOption) Handler {
+	return must(FileHandler(path, fmtr, opts...))
 }
 
 func (m muster) NetHandler(network, addr string, fmtr Format) Handler {
@@ -24,3 +24,11 @@ func (h *swapHandler) Get() Handler {
 func (h *swapHandler) Swap(newHandler Handler) {
 	atomic.StorePointer(&h.handler, unsafe.Pointer(&newHandler))
 }
+
+func (h *swapHandler) Flush() error {
+	return Flush(h.Get())
+}
+
+func (h *swapHandler) Close() error {
+	return Close(h.Get())
+}
@@ -21,3 +21,11 @@ func (h *swapHandler) Swap(newHandler Handler) {
 func (h *swapHandler) Get() Handler {
 	return *h.handler.Load().(*Handler)
 }
+
+func (h *swapHandler) Flush() error {
+	return Flush(h.Get())
+}
+
+func (h *swapHandler) Close() error {
+	return Close(h.Get())
+}
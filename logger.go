@@ -1,10 +1,11 @@
 package log15
 
 import (
+	"context"
 	"fmt"
-	"path/filepath"
-	"runtime"
+	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +16,6 @@ const callKey = "call"
 const errorKey = "LOG15_ERROR"
 const reqIDKey = "reqid"
 
-var (
-	//global variables
-	logLevel     byte //used for UDPLogger, 256 types enough
-	logMetaKey   string
-	logMetaValue string
-)
-
 type Lvl int
 
 const (
@@ -30,11 +24,14 @@ const (
 	LvlWarn
 	LvlInfo
 	LvlDebug
+	LvlTrace
 )
 
 // Returns the name of a Lvl
 func (l Lvl) String() string {
 	switch l {
+	case LvlTrace:
+		return "trce"
 	case LvlDebug:
 		return "dbug"
 	case LvlInfo:
@@ -46,7 +43,28 @@ func (l Lvl) String() string {
 	case LvlCrit:
 		return "crit"
 	default:
-		panic("bad level")
+		return "lvl(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// LongName returns the full upper case name of a Lvl: "DEBUG" rather than
+// "dbug". Use it with WithLevelNames.
+func (l Lvl) LongName() string {
+	switch l {
+	case LvlTrace:
+		return "TRACE"
+	case LvlDebug:
+		return "DEBUG"
+	case LvlInfo:
+		return "INFO"
+	case LvlWarn:
+		return "WARN"
+	case LvlError:
+		return "ERROR"
+	case LvlCrit:
+		return "CRIT"
+	default:
+		return "LVL(" + strconv.Itoa(int(l)) + ")"
 	}
 }
 
@@ -54,6 +72,8 @@ func (l Lvl) String() string {
 // Useful for parsing command line args and configuration files.
 func LvlFromString(lvlString string) (Lvl, error) {
 	switch lvlString {
+	case "trace", "trce":
+		return LvlTrace, nil
 	case "debug", "dbug":
 		return LvlDebug, nil
 	case "info":
@@ -95,10 +115,38 @@ type Record struct {
 	MetaK        string
 	MetaV        string
 	Ctx          []interface{}
-	Call         string
-	CustomCaller string
+	Call         string  // file:line of the logging call
+	PC           uintptr // program counter of the logging call, see Caller
+	CustomCaller string  // caller passed to GormInfo, Call holds it as well
 	RequestID    string
 	KeyNames     RecordKeyNames
+	// Stack holds the program counters of the call stack of the logging
+	// call if the record's level is at or above the one set with
+	// SetStackCaptureLevel, see CallStack
+	Stack []uintptr
+}
+
+// Caller returns the logging call of r, with its function name and full
+// file path. It is the zero Call if the record has no PC.
+func (r *Record) Caller() Call {
+	if r.PC == 0 {
+		return Call{}
+	}
+	return CallerAt(r.PC)
+}
+
+// CallStack returns the call stack captured for r, or nil if none was.
+func (r *Record) CallStack() CallStack {
+	return NewCallStack(r.Stack)
+}
+
+// copy returns a shallow copy of r with its own Ctx slice, so that handlers
+// appending to or rewriting the context of one copy don't affect the other.
+func (r *Record) copy() *Record {
+	c := *r
+	c.Ctx = make([]interface{}, len(r.Ctx))
+	copy(c.Ctx, r.Ctx)
+	return &c
 }
 
 type RecordKeyNames struct {
@@ -109,6 +157,14 @@ type RecordKeyNames struct {
 	ReqID string
 }
 
+var defaultKeyNames = RecordKeyNames{
+	Time:  timeKey,
+	Msg:   msgKey,
+	Lvl:   lvlKey,
+	Call:  callKey,
+	ReqID: reqIDKey,
+}
+
 // A Logger writes key/value pairs to a Handler
 type Logger interface {
 	// New returns a new Logger that has this logger's context plus the given context
@@ -123,65 +179,111 @@ type Logger interface {
 	// Set setLv value. only level below this can be output --[stevenimi]
 	SetOutLevel(l Lvl)
 
+	// GetOutLevel returns the level set with SetOutLevel or, if none was
+	// set, the level inherited from the logger this one was derived from
+	GetOutLevel() Lvl
+
+	// ResetOutLevel undoes SetOutLevel, the level is inherited again
+	ResetOutLevel()
+
+	// SetClock sets the Clock stamping this logger's records. A nil Clock
+	// falls back to the package-wide one, see SetClock.
+	SetClock(c Clock)
+
+	// WithContext returns a Logger which takes the request ID and fields
+	// carried by ctx into every record it writes
+	WithContext(ctx context.Context) Logger
+
+	// WithCallerSkip returns a Logger which reports as caller the function
+	// n frames further up the stack, for use by wrappers around a Logger.
+	// The skips of nested calls add up. See also Helper
+	WithCallerSkip(n int) Logger
+
 	// Log a message at the given level with context key/value pairs
+	Trace(msg string, ctx ...interface{})
 	Debug(msg string, ctx ...interface{})
 	Info(msg string, ctx ...interface{})
 	Warn(msg string, ctx ...interface{})
 	Error(msg string, ctx ...interface{})
 	Crit(msg string, ctx ...interface{})
+
+	// Fatal logs a message at LvlCrit, flushes the handlers and exits the
+	// program with status 1
+	Fatal(msg string, ctx ...interface{})
+
+	// Panic logs a message at LvlCrit, flushes the handlers and panics
+	// with the message
+	Panic(msg string, ctx ...interface{})
+
+	// Log a message at the given level, taking the request ID and fields
+	// from reqCtx, see ContextWithRequestID and ContextWithFields. The
+	// fields of a context bound with WithContext are kept, its request ID
+	// is used if reqCtx has none
+	TraceCtx(reqCtx context.Context, msg string, ctx ...interface{})
+	DebugCtx(reqCtx context.Context, msg string, ctx ...interface{})
+	InfoCtx(reqCtx context.Context, msg string, ctx ...interface{})
+	WarnCtx(reqCtx context.Context, msg string, ctx ...interface{})
+	ErrorCtx(reqCtx context.Context, msg string, ctx ...interface{})
+	CritCtx(reqCtx context.Context, msg string, ctx ...interface{})
 }
 
 type logger struct {
 	ctx []interface{}
 	h   *swapHandler
 	// keep the set level,only below the level can be output --[stevenmi]
-	setLv Lvl
+	// accessed atomically, it may be changed at runtime by LevelHandler.
+	// lvlUnset means the level of parent applies
+	setLv int32
+	// clock overrides the package-wide Clock when not nil
+	clock Clock
+	// reqCtx is the context bound by WithContext, nil if none
+	reqCtx context.Context
+	// parent is the logger the level is inherited from, nil for the root
+	parent *logger
+	// skip is the number of extra stack frames between the logging call
+	// reported as caller and this logger's methods, see WithCallerSkip
+	skip int
 }
 
-func (l *logger) write(msg string, lvl Lvl, ctx []interface{}) {
-	if lvl <= l.setLv { //  --[stevenmi]
+// lvlUnset marks a logger which inherits its level from its parent.
+const lvlUnset = -1
+
+// now returns the timestamp for a record written by l.
+func (l *logger) now() time.Time {
+	if l.clock != nil {
+		return l.clock.Now()
+	}
+	return GetClock().Now()
+}
+
+func (l *logger) write(reqCtx context.Context, msg string, lvl Lvl, ctx []interface{}) {
+	if lvl <= l.GetOutLevel() { //  --[stevenmi]
 		// add requestid at log head    -- 2019-9-17
-		reqID := ""
-		value, ok := GetReqIDForGoroutine()
-		if ok {
-			reqID = value.(string)
+		reqID, fields := requestMeta(l.reqCtx, reqCtx)
+		prefix := l.ctx
+		if len(fields) > 0 {
+			prefix = newContext(l.ctx, fields)
 		}
 
 		// caller
-		var caller = ""
-		_, file, line, ok := runtime.Caller(2)
-		if ok {
-			file = filepath.Base(file)
-			caller = file + ":" + strconv.Itoa(line)
-		}
+		pc, caller := callSite(2 + l.skip)
 
-		var ttime time.Time
-		loc, err := time.LoadLocation("Asia/Chongqing") //Asia/Chongqing
-		if err != nil {
-			ttime = time.Now()
-		} else {
-			ttime = time.Now().In(loc)
-		}
 		l.h.Log(&Record{
-			Time: ttime,
-			Lvl:  lvl,
-			Msg:  msg,
-			Ctx:  newContext(l.ctx, ctx),
-			Call: caller,
-			KeyNames: RecordKeyNames{
-				Time:  timeKey,
-				Msg:   msgKey,
-				Lvl:   lvlKey,
-				Call:  callKey,
-				ReqID: reqIDKey,
-			},
+			Time:      l.now(),
+			Lvl:       lvl,
+			Msg:       msg,
+			Ctx:       newContext(prefix, ctx),
+			Call:      caller,
+			PC:        pc,
+			KeyNames:  defaultKeyNames,
 			RequestID: reqID,
+			Stack:     captureStack(lvl, 2+l.skip),
 		})
 	} // --[stevenmi]
 }
 
 func (l *logger) writeMeta(msg string, lvl Lvl, metaType Meta, metaData interface{}, ctx []interface{}) {
-	if lvl <= l.setLv {
+	if lvl <= l.GetOutLevel() {
 		metaK := metaType.String()
 		metaV := formatLogfmtValue(metaData)
 
@@ -191,65 +293,71 @@ func (l *logger) writeMeta(msg string, lvl Lvl, metaType Meta, metaData interfac
 		newCtx = append(newCtx, ctx...)
 
 		// add requestid at log head    -- 2019-9-17
-		reqID := ""
-		value, ok := GetReqIDForGoroutine()
-		if ok {
-			reqID = value.(string)
+		reqID, fields := requestMeta(l.reqCtx, nil)
+		prefix := l.ctx
+		if len(fields) > 0 {
+			prefix = newContext(l.ctx, fields)
 		}
 
 		// caller
-		var caller = ""
-		_, file, line, ok := runtime.Caller(2)
-		if ok {
-			file = filepath.Base(file)
-			caller = file + ":" + strconv.Itoa(line)
-		}
+		pc, caller := callSite(2 + l.skip)
 
 		l.h.Log(&Record{
-			Time:  time.Now(),
-			Lvl:   lvl,
-			Msg:   msg,
-			MetaK: metaK,
-			MetaV: metaV,
-			Ctx:   newContext(l.ctx, newCtx),
-			Call:  caller,
-			KeyNames: RecordKeyNames{
-				Time:  timeKey,
-				Msg:   msgKey,
-				Lvl:   lvlKey,
-				Call:  callKey,
-				ReqID: reqIDKey,
-			},
+			Time:      l.now(),
+			Lvl:       lvl,
+			Msg:       msg,
+			MetaK:     metaK,
+			MetaV:     metaV,
+			Ctx:       newContext(prefix, newCtx),
+			Call:      caller,
+			PC:        pc,
+			KeyNames:  defaultKeyNames,
 			RequestID: reqID,
+			Stack:     captureStack(lvl, 2+l.skip),
 		})
 	}
 }
 
 func (l *logger) writeGorm(msg string, lvl Lvl, caller string, ctx []interface{}) {
-	if lvl <= l.setLv {
+	if lvl <= l.GetOutLevel() {
 		newCtx := make([]interface{}, 0, len(ctx))
 		newCtx = append(newCtx, ctx...)
 
+		// gorm passes the caller it found, fall back to ours without one
+		var pc uintptr
+		call := caller
+		if call == "" {
+			pc, call = callSite(2 + l.skip)
+		}
+
 		l.h.Log(&Record{
-			Time:         time.Now(),
+			Time:         l.now(),
 			Lvl:          lvl,
 			Msg:          msg,
 			Ctx:          newContext(l.ctx, newCtx),
+			Call:         call,
+			PC:           pc,
 			CustomCaller: caller,
-			KeyNames: RecordKeyNames{
-				Time:  timeKey,
-				Msg:   msgKey,
-				Lvl:   lvlKey,
-				Call:  callKey,
-				ReqID: reqIDKey,
-			},
+			KeyNames:     defaultKeyNames,
 		})
 	}
 }
 
 func (l *logger) New(ctx ...interface{}) Logger {
 	//child := &logger{newContext(l.ctx, ctx), new(swapHandler)}  // increase one parament --[stevenmi]
-	child := &logger{newContext(l.ctx, ctx), new(swapHandler), LvlDebug}
+	child := &logger{newContext(l.ctx, ctx), new(swapHandler), lvlUnset, l.clock, l.reqCtx, l, l.skip}
+	child.SetHandler(l.h)
+	return child
+}
+
+func (l *logger) WithContext(ctx context.Context) Logger {
+	child := &logger{l.ctx, new(swapHandler), lvlUnset, l.clock, ctx, l, l.skip}
+	child.SetHandler(l.h)
+	return child
+}
+
+func (l *logger) WithCallerSkip(n int) Logger {
+	child := &logger{l.ctx, new(swapHandler), lvlUnset, l.clock, l.reqCtx, l, l.skip + n}
 	child.SetHandler(l.h)
 	return child
 }
@@ -264,30 +372,106 @@ func newContext(prefix []interface{}, suffix []interface{}) []interface{} {
 
 // implement , set the Level --[stevenmi]
 func (l *logger) SetOutLevel(level Lvl) {
-	if level >= LvlCrit && level <= LvlDebug {
-		l.setLv = level
+	if level >= LvlCrit && level <= LvlTrace {
+		atomic.StoreInt32(&l.setLv, int32(level))
 	}
 	return
 }
 
+// GetOutLevel returns the level of l or, if it was never set, that of the
+// nearest ancestor which has one.
+func (l *logger) GetOutLevel() Lvl {
+	for ; l.parent != nil; l = l.parent {
+		if lv := atomic.LoadInt32(&l.setLv); lv != lvlUnset {
+			return Lvl(lv)
+		}
+	}
+	return Lvl(atomic.LoadInt32(&l.setLv))
+}
+
+// ResetOutLevel makes l inherit the level of its parent again after
+// SetOutLevel. It has no effect on the root logger.
+func (l *logger) ResetOutLevel() {
+	if l.parent != nil {
+		atomic.StoreInt32(&l.setLv, lvlUnset)
+	}
+}
+
+func (l *logger) SetClock(c Clock) {
+	l.clock = c
+}
+
+func (l *logger) Trace(msg string, ctx ...interface{}) {
+	l.write(l.reqCtx, msg, LvlTrace, ctx)
+}
+
 func (l *logger) Debug(msg string, ctx ...interface{}) {
-	l.write(msg, LvlDebug, ctx)
+	l.write(l.reqCtx, msg, LvlDebug, ctx)
 }
 
 func (l *logger) Info(msg string, ctx ...interface{}) {
-	l.write(msg, LvlInfo, ctx)
+	l.write(l.reqCtx, msg, LvlInfo, ctx)
 }
 
 func (l *logger) Warn(msg string, ctx ...interface{}) {
-	l.write(msg, LvlWarn, ctx)
+	l.write(l.reqCtx, msg, LvlWarn, ctx)
 }
 
 func (l *logger) Error(msg string, ctx ...interface{}) {
-	l.write(msg, LvlError, ctx)
+	l.write(l.reqCtx, msg, LvlError, ctx)
 }
 
 func (l *logger) Crit(msg string, ctx ...interface{}) {
-	l.write(msg, LvlCrit, ctx)
+	l.write(l.reqCtx, msg, LvlCrit, ctx)
+}
+
+func (l *logger) TraceCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlTrace, ctx)
+}
+
+func (l *logger) DebugCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlDebug, ctx)
+}
+
+func (l *logger) InfoCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlInfo, ctx)
+}
+
+func (l *logger) WarnCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlWarn, ctx)
+}
+
+func (l *logger) ErrorCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlError, ctx)
+}
+
+func (l *logger) CritCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	l.write(reqCtx, msg, LvlCrit, ctx)
+}
+
+func (l *logger) Fatal(msg string, ctx ...interface{}) {
+	l.write(l.reqCtx, msg, LvlCrit, ctx)
+	l.fatal()
+}
+
+func (l *logger) Panic(msg string, ctx ...interface{}) {
+	l.write(l.reqCtx, msg, LvlCrit, ctx)
+	l.panic(msg)
+}
+
+// exitFunc is called by Fatal, it is a variable so that it can be stubbed.
+var exitFunc = os.Exit
+
+// fatal flushes the handlers of l and exits.
+func (l *logger) fatal() {
+	Flush(l.h)
+	exitFunc(1)
+}
+
+// panic flushes the handlers of l and panics with msg.
+func (l *logger) panic(msg string) {
+	Flush(l.h)
+	panic(msg)
 }
 
 func (l *logger) GetHandler() Handler {
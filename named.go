@@ -0,0 +1,60 @@
+package log15
+
+import (
+	"strings"
+	"sync"
+)
+
+// named holds the loggers created by Named, keyed by their dotted name.
+var named = struct {
+	sync.Mutex
+	m map[string]*logger
+}{m: make(map[string]*logger)}
+
+const loggerKey = "logger"
+
+// Named returns the logger called name, creating it on first use. Names
+// form a hierarchy separated by dots: "db.pool" is a child of "db", which
+// is a child of the root logger. A named logger inherits the level and the
+// handler of its parent until SetOutLevel or SetHandler is called on it,
+// which then also applies to its own children:
+//
+//     log.Named("db").SetOutLevel(log.LvlWarn)       // quiet the db module...
+//     log.Named("db.pool").SetOutLevel(log.LvlDebug) // ...except the pool
+//
+// Every record of a named logger carries its name under the "logger" key.
+// Named loggers are registered with LevelHandler under their name. An
+// empty name returns the root logger.
+func Named(name string) Logger {
+	return namedLogger(strings.Trim(name, "."))
+}
+
+func namedLogger(name string) *logger {
+	if name == "" {
+		return root
+	}
+
+	named.Lock()
+	l, ok := named.m[name]
+	named.Unlock()
+	if ok {
+		return l
+	}
+
+	parent := root
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		parent = namedLogger(name[:i])
+	}
+
+	named.Lock()
+	defer named.Unlock()
+	if l, ok := named.m[name]; ok {
+		// created concurrently
+		return l
+	}
+	l = &logger{newContext(root.ctx, []interface{}{loggerKey, name}), new(swapHandler), lvlUnset, nil, nil, parent, 0}
+	l.SetHandler(parent.h)
+	named.m[name] = l
+	RegisterLogger(name, l)
+	return l
+}
@@ -0,0 +1,286 @@
+package log15
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnState is the connection state of a ReconnectingHandler.
+type ConnState int32
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int32(s))
+	}
+}
+
+// ErrQueueFull is returned by a ReconnectingHandler which can't queue a
+// record because the peer has been unreachable for too long.
+var ErrQueueFull = errors.New("log15: network handler queue is full")
+
+// A NetOption configures a ReconnectingHandler.
+type NetOption func(h *ReconnectingHandler)
+
+// WithTLS makes the handler connect with TLS using cfg.
+func WithTLS(cfg *tls.Config) NetOption {
+	return func(h *ReconnectingHandler) {
+		h.tlsConfig = cfg
+	}
+}
+
+// WithBackoff sets the delay before the first reconnection attempt, which
+// doubles after every failed attempt up to max. The default is 100ms to 30s.
+func WithBackoff(min, max time.Duration) NetOption {
+	return func(h *ReconnectingHandler) {
+		h.minBackoff, h.maxBackoff = min, max
+	}
+}
+
+// WithQueueSize sets how many records are kept while disconnected, 1024 by
+// default.
+func WithQueueSize(n int) NetOption {
+	return func(h *ReconnectingHandler) {
+		h.queueSize = n
+	}
+}
+
+// WithDialTimeout bounds every connection attempt, 5s by default.
+func WithDialTimeout(d time.Duration) NetOption {
+	return func(h *ReconnectingHandler) {
+		h.dialTimeout = d
+	}
+}
+
+// WithConnStateCallback registers fn to be called from the writer goroutine
+// whenever the connection state changes.
+func WithConnStateCallback(fn func(s ConnState)) NetOption {
+	return func(h *ReconnectingHandler) {
+		h.onState = fn
+	}
+}
+
+// ReconnectingHandler writes formatted records to a stream socket like
+// NetHandler, but survives the peer going away: records are queued while
+// disconnected and the connection is re-established with exponential
+// backoff. Log never blocks; once the queue is full it returns ErrQueueFull,
+// so it can be combined with FailoverHandler to fall back to a file:
+//
+//     log.FailoverHandler(
+//         log.ReconnectingNetHandler("tcp", "logs:9090", log.JsonFormat()),
+//         log.Must.FileHandler("/var/log/app.log", log.LogfmtFormat()))
+//
+type ReconnectingHandler struct {
+	// accessed atomically, kept first for alignment
+	pending int64
+	state   int32
+
+	network, addr string
+	tlsConfig     *tls.Config
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	queueSize     int
+	dialTimeout   time.Duration
+	onState       func(s ConnState)
+
+	lazy      Handler
+	fmtr      Format
+	mu        sync.RWMutex // held for reading by enqueue while it sends on queue
+	closed    bool         // guarded by mu, set by Close
+	queue     chan []byte
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ReconnectingNetHandler returns a *ReconnectingHandler for the given
+// stream network ("tcp", "unix", ...) and address. It connects in the
+// background, so it never fails; see ReconnectingHandler.State for the
+// connection state.
+func ReconnectingNetHandler(network, addr string, fmtr Format, opts ...NetOption) Handler {
+	h := &ReconnectingHandler{
+		network:     network,
+		addr:        addr,
+		fmtr:        fmtr,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  30 * time.Second,
+		queueSize:   1024,
+		dialTimeout: 5 * time.Second,
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.queue = make(chan []byte, h.queueSize)
+	h.lazy = LazyHandler(FuncHandler(h.enqueue))
+	go h.run()
+	return h
+}
+
+func (h *ReconnectingHandler) Log(r *Record) error {
+	return h.lazy.Log(r)
+}
+
+func (h *ReconnectingHandler) enqueue(r *Record) error {
+	msg := h.fmtr.Format(r)
+
+	// Close waits for the sends under the read lock, so that nothing is
+	// queued once the writer is gone
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return errHandlerClosed
+	}
+	atomic.AddInt64(&h.pending, 1)
+	select {
+	case h.queue <- msg:
+		return nil
+	default:
+		atomic.AddInt64(&h.pending, -1)
+		return ErrQueueFull
+	}
+}
+
+// State returns the current connection state.
+func (h *ReconnectingHandler) State() ConnState {
+	return ConnState(atomic.LoadInt32(&h.state))
+}
+
+func (h *ReconnectingHandler) setState(s ConnState) {
+	if ConnState(atomic.SwapInt32(&h.state, int32(s))) != s && h.onState != nil {
+		h.onState(s)
+	}
+}
+
+func (h *ReconnectingHandler) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: h.dialTimeout}
+	if h.tlsConfig != nil {
+		return tls.DialWithDialer(d, h.network, h.addr, h.tlsConfig)
+	}
+	return d.Dial(h.network, h.addr)
+}
+
+// connect dials until it succeeds or the handler is closed.
+func (h *ReconnectingHandler) connect() net.Conn {
+	backoff := h.minBackoff
+	for {
+		h.setState(StateConnecting)
+		conn, err := h.dial()
+		if err == nil {
+			h.setState(StateConnected)
+			return conn
+		}
+		h.setState(StateDisconnected)
+
+		select {
+		case <-time.After(backoff):
+		case <-h.quit:
+			return nil
+		}
+		if backoff *= 2; backoff > h.maxBackoff {
+			backoff = h.maxBackoff
+		}
+	}
+}
+
+func (h *ReconnectingHandler) run() {
+	defer close(h.done)
+
+	var conn net.Conn
+	var msg []byte // the message being written, kept across reconnects
+	for {
+		if msg == nil {
+			select {
+			case msg = <-h.queue:
+			case <-h.quit:
+				if conn != nil {
+					h.drain(conn)
+				}
+				return
+			}
+		}
+
+		if conn == nil {
+			if conn = h.connect(); conn == nil {
+				return
+			}
+		}
+
+		if _, err := conn.Write(msg); err != nil {
+			conn.Close()
+			conn = nil
+			h.setState(StateDisconnected)
+			continue
+		}
+		msg = nil
+		atomic.AddInt64(&h.pending, -1)
+	}
+}
+
+// drain writes what is left in the queue on close, without reconnecting.
+func (h *ReconnectingHandler) drain(conn net.Conn) {
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(h.dialTimeout))
+	for {
+		select {
+		case msg := <-h.queue:
+			if _, err := conn.Write(msg); err != nil {
+				return
+			}
+			atomic.AddInt64(&h.pending, -1)
+		default:
+			return
+		}
+	}
+}
+
+// Flush waits until the queue is empty. It gives up and returns an error if
+// that takes longer than the dial timeout, e.g. while disconnected.
+func (h *ReconnectingHandler) Flush() error {
+	deadline := time.Now().Add(h.dialTimeout)
+	for atomic.LoadInt64(&h.pending) > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("log15: %d records still queued for %s", atomic.LoadInt64(&h.pending), h.addr)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Close writes out the queued records if connected, then closes the
+// connection. Records queued while disconnected are discarded.
+func (h *ReconnectingHandler) Close() error {
+	h.closeOnce.Do(func() {
+		h.mu.Lock()
+		h.closed = true
+		h.mu.Unlock()
+		close(h.quit)
+		<-h.done
+		h.setState(StateClosed)
+	})
+	if n := atomic.LoadInt64(&h.pending); n > 0 {
+		return fmt.Errorf("log15: discarded %d records queued for %s", n, h.addr)
+	}
+	return nil
+}
@@ -3,12 +3,15 @@ package log15
 import (
 	"context"
 	"github.com/petermattis/goid"
+	"sort"
 	"sync"
+	"time"
 )
 
 type storeMeta struct {
 	reqID      interface{}
 	reqContext context.Context
+	created    time.Time
 }
 
 var (
@@ -16,10 +19,15 @@ var (
 )
 
 // Set 保存一个 RequestID, context
+//
+// This is the legacy API: prefer ContextWithRequestID together with the
+// *Ctx logging methods, which do not depend on the goroutine ID. The value
+// stored here is only used for records whose context carries no request ID.
 func SetReqMetaForGoroutine(ctx context.Context, ID interface{}) {
 	requestIDs.Store(getGoID(), storeMeta{
 		reqID:      ID,
 		reqContext: ctx,
+		created:    time.Now(),
 	})
 }
 
@@ -51,6 +59,79 @@ func DeleteMetaForGoroutine() {
 	requestIDs.Delete(getGoID())
 }
 
+// Go 启动一个新的 goroutine 执行 fn, 新 goroutine 继承当前 goroutine 的
+// RequestID 和 context, fn 返回后自动删除, 不会在 requestIDs 中遗留.
+//
+// Go runs fn in a new goroutine which inherits the request metadata set by
+// SetReqMetaForGoroutine in the calling goroutine. The metadata is removed
+// again when fn returns, even if it panics.
+func Go(fn func()) {
+	meta, ok := getReqMetaForGoroutine()
+	go func() {
+		if ok {
+			m := meta.(storeMeta)
+			m.created = time.Now()
+			requestIDs.Store(getGoID(), m)
+			defer DeleteMetaForGoroutine()
+		}
+		fn()
+	}()
+}
+
+// RequestIDEntry describes one live entry of the per-goroutine store.
+type RequestIDEntry struct {
+	GoID  int64
+	ReqID interface{}
+	Age   time.Duration
+}
+
+// RequestIDStat is a snapshot of the per-goroutine request metadata store.
+type RequestIDStat struct {
+	Live    int              // number of goroutine IDs holding metadata
+	Oldest  time.Duration    // age of the oldest entry
+	Entries []RequestIDEntry // all entries, oldest first
+}
+
+// RequestIDStats reports how many goroutines hold request metadata and how
+// old it is. Entries that live much longer than a request are usually
+// leaked by a missing DeleteMetaForGoroutine, and will be stamped on
+// unrelated records if the goroutine ID is reused by a worker.
+func RequestIDStats() RequestIDStat {
+	var stat RequestIDStat
+	now := time.Now()
+	requestIDs.Range(func(k, v interface{}) bool {
+		m := v.(storeMeta)
+		stat.Entries = append(stat.Entries, RequestIDEntry{
+			GoID:  k.(int64),
+			ReqID: m.reqID,
+			Age:   now.Sub(m.created),
+		})
+		return true
+	})
+	sort.Slice(stat.Entries, func(i, j int) bool {
+		return stat.Entries[i].Age > stat.Entries[j].Age
+	})
+	stat.Live = len(stat.Entries)
+	if stat.Live > 0 {
+		stat.Oldest = stat.Entries[0].Age
+	}
+	return stat
+}
+
+// DeleteStaleMeta 删除存在时间超过 maxAge 的 RequestID, 返回删除的个数.
+func DeleteStaleMeta(maxAge time.Duration) int {
+	n := 0
+	now := time.Now()
+	requestIDs.Range(func(k, v interface{}) bool {
+		if now.Sub(v.(storeMeta).created) > maxAge {
+			requestIDs.Delete(k)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
 func getGoID() int64 {
 	return goid.Get()
 }
@@ -1,10 +1,10 @@
 package log15
 
 import (
+	"context"
 	"os"
 
 	"github.com/mattn/go-colorable"
-	"github.com/xuexihuang/new_log15/term"
 )
 
 var (
@@ -14,17 +14,18 @@ var (
 )
 
 func init() {
-	if term.IsTty(os.Stdout.Fd()) {
-		StdoutHandler = StreamHandler(colorable.NewColorableStdout(), TerminalFormat())
+	if f := defaultTermFormat(os.Stdout.Fd()); f != nil {
+		StdoutHandler = StreamHandler(colorable.NewColorableStdout(), f)
 	}
 
-	if term.IsTty(os.Stderr.Fd()) {
-		StderrHandler = StreamHandler(colorable.NewColorableStderr(), TerminalFormat())
+	if f := defaultTermFormat(os.Stderr.Fd()); f != nil {
+		StderrHandler = StreamHandler(colorable.NewColorableStderr(), f)
 	}
 
 	//root = &logger{[]interface{}{}, new(swapHandler)}
-	root = &logger{[]interface{}{}, new(swapHandler), LvlDebug}
+	root = &logger{[]interface{}{}, new(swapHandler), int32(LvlDebug), nil, nil, nil, 0}
 	root.SetHandler(StdoutHandler)
+	RegisterLogger("root", root)
 }
 
 // New returns a new logger with the given context.
@@ -33,47 +34,135 @@ func New(ctx ...interface{}) Logger {
 	return root.New(ctx...)
 }
 
+// WithContext returns a logger which takes the request ID and fields carried
+// by ctx into every record it writes.
+// WithContext is a convenient alias for Root().WithContext
+func WithContext(ctx context.Context) Logger {
+	return root.WithContext(ctx)
+}
+
+// WithCallerSkip returns a logger which reports as caller the function n
+// frames further up the stack.
+// WithCallerSkip is a convenient alias for Root().WithCallerSkip
+func WithCallerSkip(n int) Logger {
+	return root.WithCallerSkip(n)
+}
+
 // Root returns the root logger
 func Root() Logger {
 	return root
 }
 
+// SetOutLevel sets the level of the root logger. If isForceSetColor is
+// true the root logger writes to stdout in TerminalFormat, colored even if
+// stdout is not a terminal, unless the NO_COLOR environment variable is set.
 func SetOutLevel(level Lvl, isForceSetColor bool) {
 	if isForceSetColor {
-		StdoutHandler = StreamHandler(colorable.NewColorableStdout(), TerminalFormat())
-		StderrHandler = StreamHandler(colorable.NewColorableStderr(), TerminalFormat())
+		StdoutHandler = StreamHandler(colorable.NewColorableStdout(), terminalFormat(!noColor()))
+		StderrHandler = StreamHandler(colorable.NewColorableStderr(), terminalFormat(!noColor()))
 		root.SetHandler(StdoutHandler)
 	}
 	root.SetOutLevel(level)
 }
 
+// Shutdown flushes and then closes the root handler and everything it
+// wraps: buffered records are written out, files and sockets are closed.
+// Call it before the program exits, e.g. deferred in main or right before
+// os.Exit, or records still queued in asynchronous handlers are lost.
+// If ctx is done first Shutdown returns ctx.Err() and leaves the remaining
+// work running in the background.
+func Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		err := Flush(root.h)
+		if cerr := Close(root.h); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // The following functions bypass the exported logger methods (logger.Debug,
 // etc.) to keep the call depth the same for all paths to logger.write so
 // runtime.Caller(2) always refers to the call site in client code.
 
+// Trace is a convenient alias for Root().Trace
+func Trace(msg string, ctx ...interface{}) {
+	root.write(nil, msg, LvlTrace, ctx)
+}
+
 // Debug is a convenient alias for Root().Debug
 func Debug(msg string, ctx ...interface{}) {
-	root.write(msg, LvlDebug, ctx)
+	root.write(nil, msg, LvlDebug, ctx)
 }
 
 // Info is a convenient alias for Root().Info
 func Info(msg string, ctx ...interface{}) {
-	root.write(msg, LvlInfo, ctx)
+	root.write(nil, msg, LvlInfo, ctx)
 }
 
 // Warn is a convenient alias for Root().Warn
 func Warn(msg string, ctx ...interface{}) {
-	root.write(msg, LvlWarn, ctx)
+	root.write(nil, msg, LvlWarn, ctx)
 }
 
 // Error is a convenient alias for Root().Error
 func Error(msg string, ctx ...interface{}) {
-	root.write(msg, LvlError, ctx)
+	root.write(nil, msg, LvlError, ctx)
 }
 
 // Crit is a convenient alias for Root().Crit
 func Crit(msg string, ctx ...interface{}) {
-	root.write(msg, LvlCrit, ctx)
+	root.write(nil, msg, LvlCrit, ctx)
+}
+
+// TraceCtx is a convenient alias for Root().TraceCtx
+func TraceCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlTrace, ctx)
+}
+
+// DebugCtx is a convenient alias for Root().DebugCtx
+func DebugCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlDebug, ctx)
+}
+
+// InfoCtx is a convenient alias for Root().InfoCtx
+func InfoCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlInfo, ctx)
+}
+
+// WarnCtx is a convenient alias for Root().WarnCtx
+func WarnCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlWarn, ctx)
+}
+
+// ErrorCtx is a convenient alias for Root().ErrorCtx
+func ErrorCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlError, ctx)
+}
+
+// CritCtx is a convenient alias for Root().CritCtx
+func CritCtx(reqCtx context.Context, msg string, ctx ...interface{}) {
+	root.write(reqCtx, msg, LvlCrit, ctx)
+}
+
+// Fatal is a convenient alias for Root().Fatal
+func Fatal(msg string, ctx ...interface{}) {
+	root.write(nil, msg, LvlCrit, ctx)
+	root.fatal()
+}
+
+// Panic is a convenient alias for Root().Panic
+func Panic(msg string, ctx ...interface{}) {
+	root.write(nil, msg, LvlCrit, ctx)
+	root.panic(msg)
 }
 
 // MetaDebug is used to mark meta by caller
@@ -81,7 +170,8 @@ func MetaDebug(msg string, metaType Meta, metaData interface{}, ctx ...interface
 	root.writeMeta(msg, LvlDebug, metaType, metaData, ctx)
 }
 
-// GormInfo is used to support gorm logger
+// GormInfo is used to support gorm logger. caller is the call site found by
+// gorm, if empty the caller of GormInfo is used
 func GormInfo(msg string, caller string, ctx ...interface{}) {
 	root.writeGorm(msg, LvlInfo, caller, ctx)
 }
@@ -0,0 +1,543 @@
+package log15
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A RotateSchedule decides when a time-rotated log file is cut.
+type RotateSchedule interface {
+	// Next returns the first rotation boundary after t.
+	Next(t time.Time) time.Time
+}
+
+// ScheduleFunc adapts an ordinary function to the RotateSchedule interface.
+type ScheduleFunc func(t time.Time) time.Time
+
+func (f ScheduleFunc) Next(t time.Time) time.Time {
+	return f(t)
+}
+
+// Every returns a schedule which cuts files every d, aligned to midnight in
+// the timezone of the package Clock when d divides a day. Every(15 *
+// time.Minute) cuts at :00, :15, :30 and :45.
+func Every(d time.Duration) RotateSchedule {
+	return ScheduleFunc(func(t time.Time) time.Time {
+		if d <= 0 {
+			return t.Add(time.Hour)
+		}
+		if (24*time.Hour)%d != 0 {
+			return t.Truncate(d).Add(d)
+		}
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return midnight.Add((t.Sub(midnight)/d + 1) * d)
+	})
+}
+
+// Hourly cuts files at the start of every hour.
+func Hourly() RotateSchedule {
+	return Every(time.Hour)
+}
+
+// Daily cuts files at midnight.
+func Daily() RotateSchedule {
+	return DailyAt(0, 0)
+}
+
+// DailyAt cuts files once a day at hour:min.
+func DailyAt(hour, min int) RotateSchedule {
+	return ScheduleFunc(func(t time.Time) time.Time {
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, min, 0, 0, t.Location())
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	})
+}
+
+// WithRotateSchedule makes the file handler cut a new file on every
+// boundary of s instead of only by size. The files are named after
+// WithFilenamePattern, by default the handler's path with the hour inserted
+// before the extension: app.log becomes app.2026-10-16-14.log. The size
+// limit, if any, still applies within a period and adds a counter:
+// app.2026-10-16-14.1.log. WithMaxBackups, WithMaxAge and WithCompress
+// apply to the files of past periods.
+func WithRotateSchedule(s RotateSchedule) FileOption {
+	return func(c *fileConf) {
+		c.schedule = s
+	}
+}
+
+// WithFilenamePattern sets the names of time-rotated files. The pattern is
+// a path in which %Y, %m, %d, %H, %M and %S are replaced by the year,
+// month, day, hour, minute and second the period started, %i by the
+// counter of size-rotated files within the period and %% by a percent
+// sign. Relative patterns are relative to the directory of the handler's
+// path.
+func WithFilenamePattern(pattern string) FileOption {
+	return func(c *fileConf) {
+		c.pattern = pattern
+	}
+}
+
+// defaultPattern inserts the period into path before its extension.
+func defaultPattern(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".%Y-%m-%d-%H" + ext
+}
+
+// expandPattern replaces the placeholders of a filename pattern.
+// A negative index leaves %i alone.
+func expandPattern(pattern string, t time.Time, index int) string {
+	var buf []byte
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 == len(pattern) {
+			buf = append(buf, c)
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			buf = t.AppendFormat(buf, "2006")
+		case 'm':
+			buf = t.AppendFormat(buf, "01")
+		case 'd':
+			buf = t.AppendFormat(buf, "02")
+		case 'H':
+			buf = t.AppendFormat(buf, "15")
+		case 'M':
+			buf = t.AppendFormat(buf, "04")
+		case 'S':
+			buf = t.AppendFormat(buf, "05")
+		case 'i':
+			if index < 0 {
+				buf = append(buf, "%i"...)
+			} else {
+				buf = strconv.AppendInt(buf, int64(index), 10)
+			}
+		case '%':
+			buf = append(buf, '%')
+		default:
+			buf = append(buf, '%', pattern[i])
+		}
+	}
+	return string(buf)
+}
+
+// globPattern turns a filename pattern into a glob matching every file it
+// may produce, and others too: the matches are only candidates for
+// backupMatcher.
+func globPattern(pattern string) string {
+	var buf []byte
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '%' && i+1 < len(pattern) && pattern[i+1] != '%' {
+			i++
+			if len(buf) == 0 || buf[len(buf)-1] != '*' {
+				buf = append(buf, '*')
+			}
+			continue
+		}
+		if c == '%' {
+			i++
+		}
+		buf = append(buf, c)
+	}
+	glob := string(buf)
+	if !strings.Contains(pattern, "%i") {
+		// size-rotated files get the counter inserted before the extension
+		ext := filepath.Ext(glob)
+		glob = strings.TrimSuffix(glob, ext) + "*" + ext
+	}
+	return glob
+}
+
+// A backupMatcher recognizes the files produced by a filename pattern.
+type backupMatcher struct {
+	re     *regexp.Regexp
+	fields []byte // placeholder of each group of re, 'c' for the counter
+}
+
+func newBackupMatcher(pattern string) *backupMatcher {
+	m := &backupMatcher{}
+	var expr strings.Builder
+	expr.WriteByte('^')
+	translate := func(p string) {
+		for i := 0; i < len(p); i++ {
+			c := p[i]
+			if c != '%' || i+1 == len(p) {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			i++
+			switch p[i] {
+			case 'Y':
+				expr.WriteString(`(\d{4})`)
+			case 'm', 'd', 'H', 'M', 'S':
+				expr.WriteString(`(\d{2})`)
+			case 'i':
+				expr.WriteString(`(\d+)`)
+			case '%':
+				expr.WriteString("%")
+				continue
+			default:
+				expr.WriteString(regexp.QuoteMeta(p[i-1 : i+1]))
+				continue
+			}
+			m.fields = append(m.fields, p[i])
+		}
+	}
+	if strings.Contains(pattern, "%i") {
+		translate(pattern)
+	} else {
+		// size-rotated files get the counter inserted before the extension
+		ext := filepath.Ext(pattern)
+		translate(strings.TrimSuffix(pattern, ext))
+		expr.WriteString(`(?:\.(\d+))?`)
+		m.fields = append(m.fields, 'i')
+		translate(ext)
+	}
+	expr.WriteString(`(?:\.gz)?$`)
+	m.re = regexp.MustCompile(expr.String())
+	return m
+}
+
+// parse returns the period start and counter that name was made from, or
+// false if name is not a file of the pattern. Names are only accepted if
+// they expand back from the parsed values, using filename, so files which
+// merely look alike are never touched.
+func (m *backupMatcher) parse(name string, loc *time.Location, filename func(time.Time, int) string) (time.Time, int, bool) {
+	match := m.re.FindStringSubmatch(name)
+	if match == nil {
+		return time.Time{}, 0, false
+	}
+	year, month, day, hour, min, sec, index := 2000, 1, 1, 0, 0, 0, 0
+	for i, field := range m.fields {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		switch field {
+		case 'Y':
+			year = n
+		case 'm':
+			month = n
+		case 'd':
+			day = n
+		case 'H':
+			hour = n
+		case 'M':
+			min = n
+		case 'S':
+			sec = n
+		case 'i':
+			index = n
+		}
+	}
+	start := time.Date(year, time.Month(month), day, hour, min, sec, 0, loc)
+	if filename(start, index) != strings.TrimSuffix(name, ".gz") {
+		return time.Time{}, 0, false
+	}
+	return start, index, true
+}
+
+// timeRotatingFile is an io.WriteCloser which writes to one file per period
+// of a RotateSchedule.
+type timeRotatingFile struct {
+	mu         sync.Mutex
+	cleanMu    sync.Mutex // serializes cleanup runs
+	pattern    string
+	schedule   RotateSchedule
+	maxSize    int64 // bytes, 0 for no limit
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	mode       os.FileMode
+	backups    *backupMatcher
+
+	file  *os.File
+	name  string
+	size  int64
+	start time.Time // start of the current period
+	next  time.Time // when the current period ends
+	index int       // counter of size rotations within the period
+}
+
+func newTimeRotatingFile(path string, c fileConf) *timeRotatingFile {
+	pattern := c.pattern
+	if pattern == "" {
+		pattern = defaultPattern(path)
+	} else if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	// in the form filepath.Glob returns names in, for cleanup
+	pattern = filepath.Clean(pattern)
+	mode := c.mode
+	if mode == 0 {
+		mode = 0644
+	}
+	return &timeRotatingFile{
+		pattern:    pattern,
+		schedule:   c.schedule,
+		maxSize:    int64(c.maxSize) * 1024 * 1024,
+		maxBackups: c.maxBackups,
+		maxAge:     time.Duration(c.maxAge) * 24 * time.Hour,
+		compress:   c.compress,
+		mode:       mode,
+		backups:    newBackupMatcher(pattern),
+	}
+}
+
+// filename returns the name of the file of the period starting at start
+// with the given size rotation counter.
+func (f *timeRotatingFile) filename(start time.Time, index int) string {
+	name := expandPattern(f.pattern, start, index)
+	if index > 0 && !strings.Contains(f.pattern, "%i") {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "." + strconv.Itoa(index) + ext
+	}
+	return name
+}
+
+func (f *timeRotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := GetClock().Now()
+	if f.file == nil || !now.Before(f.next) {
+		if err := f.openPeriod(now); err != nil {
+			return 0, err
+		}
+	} else if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.openIndex(f.index + 1); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// openPeriod opens the file of the period containing now, continuing
+// after the last size-rotated file of that period if there are any. The
+// period only changes once its file is open, so a failed open is retried
+// by the next write.
+func (f *timeRotatingFile) openPeriod(now time.Time) error {
+	next := f.schedule.Next(now)
+	if !next.After(now) {
+		return fmt.Errorf("log15: rotate schedule returned %v, not after %v", next, now)
+	}
+	start := prevBoundary(f.schedule, now, next)
+
+	index := 0
+	if f.maxSize > 0 {
+		for {
+			if _, err := os.Stat(f.filename(start, index+1)); err != nil {
+				break
+			}
+			index++
+		}
+	}
+	if err := f.openFile(start, index); err != nil {
+		return err
+	}
+	f.next = next
+	return nil
+}
+
+// prevBoundary returns the last boundary of s at or before now, or now if
+// there is none within a year. next is s.Next(now).
+func prevBoundary(s RotateSchedule, now, next time.Time) time.Time {
+	back := next.Sub(now)
+	if back <= 0 {
+		return now
+	}
+	for ; back < 366*24*time.Hour; back *= 2 {
+		b := s.Next(now.Add(-back))
+		if b.After(now) {
+			continue
+		}
+		for {
+			n := s.Next(b)
+			if n.After(now) || !n.After(b) {
+				return b
+			}
+			b = n
+		}
+	}
+	return now
+}
+
+// openIndex starts the next size-rotated file of the current period.
+func (f *timeRotatingFile) openIndex(index int) error {
+	return f.openFile(f.start, index)
+}
+
+// openFile opens the file of the period starting at start with the given
+// counter and, once it is open, switches writes over to it.
+func (f *timeRotatingFile) openFile(start time.Time, index int) error {
+	name := f.filename(start, index)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, f.mode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if f.file != nil {
+		f.file.Close()
+		go f.cleanup()
+	}
+	f.file, f.name, f.size, f.start, f.index = file, name, info.Size(), start, index
+	return nil
+}
+
+// Rotate starts a new file within the current period.
+func (f *timeRotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return f.openPeriod(GetClock().Now())
+	}
+	return f.openIndex(f.index + 1)
+}
+
+// Reopen closes the current file and opens the file of the current period
+// again, creating it if it was removed.
+func (f *timeRotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.openPeriod(GetClock().Now())
+}
+
+func (f *timeRotatingFile) current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.name
+}
+
+func (f *timeRotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// cleanup compresses and removes the files of past periods according to
+// the retention settings. Runs started by consecutive rotations take turns,
+// each looking at the file being written to when it starts.
+func (f *timeRotatingFile) cleanup() {
+	if f.maxBackups == 0 && f.maxAge == 0 && !f.compress {
+		return
+	}
+	f.cleanMu.Lock()
+	defer f.cleanMu.Unlock()
+
+	f.mu.Lock()
+	current, loc := f.name, f.start.Location()
+	f.mu.Unlock()
+
+	glob := globPattern(f.pattern)
+	plain, _ := filepath.Glob(glob)
+	gzipped, _ := filepath.Glob(glob + ".gz")
+
+	type backup struct {
+		name  string
+		start time.Time
+		index int
+	}
+	var backups []backup
+	for _, name := range append(plain, gzipped...) {
+		if name == current || name == current+".gz" {
+			continue
+		}
+		start, index, ok := f.backups.parse(name, loc, f.filename)
+		if !ok {
+			continue
+		}
+		if info, err := os.Stat(name); err != nil || info.IsDir() {
+			continue
+		}
+		backups = append(backups, backup{name, start, index})
+	}
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].start.Equal(backups[j].start) {
+			return backups[i].start.After(backups[j].start)
+		}
+		return backups[i].index > backups[j].index
+	})
+
+	now := GetClock().Now()
+	for i, b := range backups {
+		// a backup ages from the end of its period
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && now.Sub(f.schedule.Next(b.start)) > f.maxAge) {
+			os.Remove(b.name)
+			continue
+		}
+		if f.compress && !strings.HasSuffix(b.name, ".gz") {
+			if err := gzipFile(b.name); err != nil {
+				fmt.Fprintf(os.Stderr, "log15: failed to compress %s: %v\n", b.name, err)
+			}
+		}
+	}
+}
+
+// gzipFile replaces name by name.gz.
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,68 @@
+package log15
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ReopenOnSignal calls ReopenFiles whenever the process receives one of
+// sigs, SIGHUP if none are given. This is what a logrotate postrotate
+// script expects:
+//
+//     postrotate
+//         kill -HUP $(cat /var/run/app.pid)
+//     endscript
+//
+// Call the returned function to stop listening for the signals. There is no
+// default signal on Windows.
+func ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = reopenSignals
+	}
+	return onSignal(sigs, func() {
+		if err := ReopenFiles(); err != nil {
+			fmt.Fprintf(os.Stderr, "log15: failed to reopen log files: %v\n", err)
+		}
+	})
+}
+
+// RotateOnSignal calls LogRotate whenever the process receives one of sigs,
+// SIGUSR1 if none are given. Call the returned function to stop listening
+// for the signals. There is no default signal on Windows.
+func RotateOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = rotateSignals
+	}
+	return onSignal(sigs, LogRotate)
+}
+
+func onSignal(sigs []os.Signal, fn func()) (stop func()) {
+	if len(sigs) == 0 {
+		// no default signal on this platform
+		return func() {}
+	}
+
+	c := make(chan os.Signal, 1)
+	quit := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				fn()
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(quit)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+// +build windows plan9
+
+package log15
+
+import "os"
+
+// there is no SIGHUP or SIGUSR1 to listen for by default
+var (
+	reopenSignals []os.Signal
+	rotateSignals []os.Signal
+)
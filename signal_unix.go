@@ -0,0 +1,13 @@
+// +build !windows,!plan9
+
+package log15
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	reopenSignals = []os.Signal{syscall.SIGHUP}
+	rotateSignals = []os.Signal{syscall.SIGUSR1}
+)
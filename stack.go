@@ -0,0 +1,258 @@
+package log15
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxStackDepth bounds the number of frames captured for a record.
+const maxStackDepth = 32
+
+// stackLvl is the least severe level whose records get a stack, see
+// SetStackCaptureLevel. Accessed atomically.
+var stackLvl = int32(LvlError)
+
+// SetStackCaptureLevel sets the least severe level for which the call stack
+// is captured when a record is logged, LvlError by default. Capturing costs
+// a few microseconds per record. Pass Lvl(-1) to capture no stacks at all.
+// CallerStackHandler writes the captured stacks.
+func SetStackCaptureLevel(lvl Lvl) {
+	atomic.StoreInt32(&stackLvl, int32(lvl))
+}
+
+// captureStack returns the program counters of the calling goroutine's
+// stack, starting skip frames above its caller like runtime.Caller(skip)
+// would, or nil if records at lvl don't get a stack.
+func captureStack(lvl Lvl, skip int) []uintptr {
+	if lvl > Lvl(atomic.LoadInt32(&stackLvl)) {
+		return nil
+	}
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// pkgPrefix is the prefix of the function names of this package.
+var pkgPrefix = reflect.TypeOf(logger{}).PkgPath() + "."
+
+// A Call is a single frame of a call stack. It implements fmt.Formatter:
+//
+//     %s    source file name without the directory
+//     %+s   full path of the source file
+//     %#s   package path and file name, relative to the main module for its
+//           own packages: "internal/db/handler.go"
+//     %d    line number
+//     %n    function name without the package
+//     %+n   function name with the package path
+//     %v    the same as %s:%d, or %+s:%d and %#s:%d with the flags
+type Call struct {
+	frame runtime.Frame
+}
+
+// CallerAt returns the Call of the program counter pc, a return address as
+// captured by runtime.Callers.
+func CallerAt(pc uintptr) Call {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return Call{frame}
+}
+
+// callSite returns the program counter and "file:line" of the function
+// skip frames above the caller of callSite, like runtime.Caller(skip),
+// passing over functions marked with Helper.
+func callSite(skip int) (uintptr, string) {
+	var buf [16]uintptr
+	pcs := buf[:1]
+	if atomic.LoadInt32(&nHelpers) > 0 {
+		pcs = buf[:]
+	}
+	n := runtime.Callers(skip+2, pcs)
+	for i := 0; i < n; i++ {
+		frame, _ := runtime.CallersFrames(pcs[i : i+1]).Next()
+		if i+1 < n && isHelper(frame.Function) {
+			continue
+		}
+		return pcs[i], filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+	}
+	return 0, ""
+}
+
+// helpers holds the names of the functions marked with Helper.
+var (
+	helpers  sync.Map
+	nHelpers int32 // number of entries in helpers, accessed atomically
+)
+
+// Helper marks the calling function as a logging helper, like
+// testing.T.Helper: records logged from within it report the caller of
+// the helper as their call site instead.
+//
+//     func logRequest(r *http.Request, msg string) {
+//         log.Helper()
+//         log.Info(msg, "method", r.Method, "path", r.URL.Path)
+//     }
+//
+// Helpers may call each other. Use Logger.WithCallerSkip instead for
+// wrappers through which every call passes.
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, struct{}{}); !loaded {
+		atomic.AddInt32(&nHelpers, 1)
+	}
+}
+
+func isHelper(function string) bool {
+	_, ok := helpers.Load(function)
+	return ok
+}
+
+// Frame returns the runtime frame of c.
+func (c Call) Frame() runtime.Frame {
+	return c.frame
+}
+
+func (c Call) String() string {
+	return fmt.Sprint(c)
+}
+
+func (c Call) Format(s fmt.State, verb rune) {
+	if c.frame.PC == 0 && c.frame.Function == "" {
+		fmt.Fprintf(s, "%%!%c(NOFUNC)", verb)
+		return
+	}
+
+	switch verb {
+	case 's', 'v':
+		var file string
+		switch {
+		case s.Flag('+'):
+			file = c.frame.File
+		case s.Flag('#'):
+			file = c.relPath()
+		default:
+			file = filepath.Base(c.frame.File)
+		}
+		s.Write([]byte(file))
+		if verb == 'v' {
+			s.Write([]byte{':'})
+			s.Write([]byte(strconv.Itoa(c.frame.Line)))
+		}
+	case 'd':
+		s.Write([]byte(strconv.Itoa(c.frame.Line)))
+	case 'n':
+		name := c.frame.Function
+		if !s.Flag('+') {
+			name = shortFuncName(name)
+		}
+		s.Write([]byte(name))
+	default:
+		fmt.Fprintf(s, "%%!%c(log15.Call=%v)", verb, c)
+	}
+}
+
+// mainPkg and mainModule are the import paths of the main package and
+// module, used to resolve the package path of functions in package main.
+var mainPkg, mainModule = func() (string, string) {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return bi.Path, bi.Main.Path
+	}
+	return "", ""
+}()
+
+// pkgPath returns the import path of the package of c's function.
+func (c Call) pkgPath() string {
+	name := c.frame.Function
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	pkg := name[:slash+1+dot]
+	if pkg == "main" && mainPkg != "" {
+		pkg = mainPkg
+	}
+	return pkg
+}
+
+// relPath returns the package path and file name of c, relative to the
+// main module if the package is part of it.
+func (c Call) relPath() string {
+	pkg := c.pkgPath()
+	if mainModule != "" && (pkg == mainModule || strings.HasPrefix(pkg, mainModule+"/")) {
+		pkg = strings.TrimPrefix(strings.TrimPrefix(pkg, mainModule), "/")
+	}
+	return path.Join(pkg, filepath.Base(c.frame.File))
+}
+
+// shortFuncName strips the package path from a function name:
+// "github.com/a/b.(*T).M" becomes "(*T).M".
+func shortFuncName(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// CallStack is a call stack, the most recent call first. It formats as a
+// space separated list of its Calls, each formatted with the same verb and
+// flags, inside brackets: "[data.go:42 main.go:12]".
+type CallStack []Call
+
+// NewCallStack resolves the program counters captured by runtime.Callers
+// into a CallStack, leaving out the frames of this package and the runtime
+// frames at the bottom of the stack.
+func NewCallStack(pcs []uintptr) CallStack {
+	if len(pcs) == 0 {
+		return nil
+	}
+	cs := make(CallStack, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPrefix) {
+			cs = append(cs, Call{frame})
+		}
+		if !more {
+			break
+		}
+	}
+	return cs.trimRuntime()
+}
+
+// trimRuntime removes the runtime frames, like runtime.main and
+// runtime.goexit, from the bottom of cs.
+func (cs CallStack) trimRuntime() CallStack {
+	for len(cs) > 0 && strings.HasPrefix(cs[len(cs)-1].frame.Function, "runtime.") {
+		cs = cs[:len(cs)-1]
+	}
+	return cs
+}
+
+func (cs CallStack) String() string {
+	return fmt.Sprint(cs)
+}
+
+func (cs CallStack) Format(s fmt.State, verb rune) {
+	s.Write([]byte{'['})
+	for i, c := range cs {
+		if i > 0 {
+			s.Write([]byte{' '})
+		}
+		c.Format(s, verb)
+	}
+	s.Write([]byte{']'})
+}
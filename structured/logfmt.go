@@ -0,0 +1,250 @@
+package structured
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLogfmtDepth bounds how deep nested values are flattened.
+const maxLogfmtDepth = 8
+
+// LogfmtEncoder appends key/value pairs in logfmt: values are quoted only
+// when they need to be, keys are made safe, and maps, structs and slices
+// are flattened into one pair per leaf with dotted keys:
+//
+//     user.id=7 user.name=bob tags.0=a tags.1=b
+//
+// Encoder, in contrast, always quotes strings and inlines nested values as
+// JSON, which logfmt parsers can't read.
+type LogfmtEncoder struct {
+	// TimeFormat is the layout of time.Time values, RFC 3339 with
+	// milliseconds if empty
+	TimeFormat string
+}
+
+const defaultLogfmtTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// AppendKey appends key, with every byte that may not appear in a logfmt
+// key replaced by an underscore, followed by '='.
+func (LogfmtEncoder) AppendKey(dst []byte, key string) []byte {
+	if key == "" {
+		dst = append(dst, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if b <= ' ' || b == '=' || b == '"' || b == 0x7f {
+			b = '_'
+		}
+		dst = append(dst, b)
+	}
+	return append(dst, '=')
+}
+
+// AppendString appends s, quoted and escaped if it is empty or contains
+// spaces, '=', quotes, control characters or invalid UTF-8.
+func (LogfmtEncoder) AppendString(dst []byte, s string) []byte {
+	if needsQuotes(s) {
+		return Encoder{}.AppendString(dst, s)
+	}
+	return append(dst, s...)
+}
+
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b <= ' ' || b == '=' || b == '"' || b == '\\' || b == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// AppendField appends key=val, or one space separated pair per leaf if val
+// is a map, struct, slice or array. The keys of nested values are joined
+// to key with dots; map keys are sorted and struct fields named after
+// their json tag if they have one.
+func (e LogfmtEncoder) AppendField(dst []byte, key string, val interface{}) []byte {
+	return e.appendField(dst, key, val, 0)
+}
+
+func (e LogfmtEncoder) appendField(dst []byte, key string, val interface{}, depth int) []byte {
+	if s, ok := e.Text(val); ok {
+		dst = e.AppendKey(dst, key)
+		return e.AppendString(dst, s)
+	}
+
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			dst = e.AppendKey(dst, key)
+			return append(dst, "nil"...)
+		}
+		v = v.Elem()
+	}
+	if depth >= maxLogfmtDepth {
+		dst = e.AppendKey(dst, key)
+		return e.AppendString(dst, fmt.Sprintf("%+v", v.Interface()))
+	}
+
+	first := true
+	sep := func() {
+		if !first {
+			dst = append(dst, ' ')
+		}
+		first = false
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = fmt.Sprint(k.Interface())
+		}
+		idx := make([]int, len(keys))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.Slice(idx, func(a, b int) bool { return names[idx[a]] < names[idx[b]] })
+		for _, i := range idx {
+			sep()
+			dst = e.appendField(dst, key+"."+names[i], v.MapIndex(keys[i]).Interface(), depth+1)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if n := strings.Split(tag, ",")[0]; n != "" {
+					name = n
+				}
+			}
+			sep()
+			dst = e.appendField(dst, key+"."+name, v.Field(i).Interface(), depth+1)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			sep()
+			dst = e.appendField(dst, key+"."+strconv.Itoa(i), v.Index(i).Interface(), depth+1)
+		}
+
+	default:
+		sep()
+		dst = e.AppendKey(dst, key)
+		dst = e.AppendString(dst, fmt.Sprintf("%+v", v.Interface()))
+	}
+
+	if first {
+		// empty map, struct or slice
+		dst = e.AppendKey(dst, key)
+	}
+	return dst
+}
+
+// Text returns the text of val before quoting, as AppendField writes it,
+// or false if val is a map, struct, slice or array that AppendField
+// flattens.
+func (e LogfmtEncoder) Text(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case nil:
+		return "nil", true
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int8:
+		return strconv.FormatInt(int64(v), 10), true
+	case int16:
+		return strconv.FormatInt(int64(v), 10), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float32:
+		return formatLogfmtFloat(float64(v), 32), true
+	case float64:
+		return formatLogfmtFloat(v, 64), true
+	case time.Time:
+		layout := e.TimeFormat
+		if layout == "" {
+			layout = defaultLogfmtTimeFormat
+		}
+		return v.Format(layout), true
+	case time.Duration:
+		return v.String(), true
+	}
+
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "nil", true
+	}
+	switch v := val.(type) {
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	case encoding.TextMarshaler:
+		if b, err := v.MarshalText(); err == nil {
+			return string(b), true
+		}
+	case json.Marshaler:
+		if b, err := v.MarshalJSON(); err == nil {
+			return string(b), true
+		}
+	}
+	return "", false
+}
+
+func formatLogfmtFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, bitSize)
+}
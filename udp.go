@@ -0,0 +1,547 @@
+package log15
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xuexihuang/new_log15/udpagent"
+)
+
+var udpBufferPool = &sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+type UDPLogger struct {
+	// accessed atomically, kept first for alignment
+	lastAck   int64 // UnixNano of the last hello acknowledgement
+	reachable int32 // 1 while the agent is believed to be up
+
+	logAgentAddr string
+	who          string
+	connMu       sync.RWMutex // guards conn against redial
+	conn         net.Conn
+	count        uint32
+	WriteBuf     []byte
+
+	// agent reachability
+	ackTimeout time.Duration
+	heartbeat  time.Duration
+	onState    func(reachable bool)
+	spill      *spillQueue
+	acked      chan struct{}
+	closeOnce  sync.Once
+	fileOpts   []FileOption // for NetFileHandler
+
+	// protocol version 3 only
+	version       uint8
+	mu            sync.Mutex // guards packer
+	packer        udpagent.Packer
+	batchInterval time.Duration
+	quit          chan struct{}
+}
+
+func (u *UDPLogger) init() (err error) {
+	u.conn, err = net.Dial("udp", u.logAgentAddr)
+	if err != nil {
+		return err
+	}
+	u.quit = make(chan struct{})
+	u.acked = make(chan struct{}, 1)
+	u.reachable = 1
+	go u.readLoop()
+
+	u.sayHello()
+	if u.ackTimeout > 0 {
+		select {
+		case <-u.acked:
+		case <-time.After(u.ackTimeout):
+			u.setReachable(false)
+		}
+	}
+
+	if u.version == udpagent.Version3 && u.batchInterval > 0 {
+		u.packer.Batch = true
+		go u.flushLoop()
+	}
+	if u.heartbeat > 0 {
+		go u.heartbeatLoop()
+	}
+	if u.spill != nil && u.Reachable() && u.spill.startReplay() {
+		// records left over from a previous run
+		go u.replay()
+	}
+	return
+}
+
+// readLoop receives the agent's replies to hello packets.
+func (u *UDPLogger) readLoop() {
+	var buf [1024]byte
+	for {
+		conn := u.getConn()
+		n, err := conn.Read(buf[0:])
+		if err != nil {
+			select {
+			case <-u.quit:
+				return
+			default:
+			}
+			// a refused connection means nothing listens on the agent port
+			if u.tracksAgent() {
+				u.setReachable(false)
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if n >= 2 && buf[0] == 0xEF && buf[1] == 0xEE {
+			atomic.StoreInt64(&u.lastAck, time.Now().UnixNano())
+			select {
+			case u.acked <- struct{}{}:
+			default:
+			}
+			u.setReachable(true)
+		}
+	}
+}
+
+func (u *UDPLogger) heartbeatLoop() {
+	t := time.NewTicker(u.heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			u.sayHello()
+			last := time.Unix(0, atomic.LoadInt64(&u.lastAck))
+			if time.Since(last) > 3*u.heartbeat {
+				u.setReachable(false)
+			}
+		case <-u.quit:
+			return
+		}
+	}
+}
+
+// tracksAgent reports whether the agent's acknowledgements are watched, so
+// that silence means it is down.
+func (u *UDPLogger) tracksAgent() bool {
+	return u.ackTimeout > 0 || u.heartbeat > 0
+}
+
+// Reachable reports whether the agent is believed to be up. Without
+// WithHelloAck or WithHeartbeat it is always true.
+func (u *UDPLogger) Reachable() bool {
+	return atomic.LoadInt32(&u.reachable) == 1
+}
+
+func (u *UDPLogger) setReachable(up bool) {
+	var v int32
+	if up {
+		v = 1
+	}
+	if atomic.LoadInt32(&u.reachable) == v {
+		return
+	}
+	// the replay is marked before the agent is, so that no live record
+	// passes the spilled ones
+	replay := up && u.spill != nil && u.spill.startReplay()
+	if replay {
+		defer func() { go u.replay() }()
+	}
+	if atomic.SwapInt32(&u.reachable, v) == v {
+		return
+	}
+	if !up {
+		u.redial()
+	}
+	if u.onState != nil {
+		u.onState(up)
+	}
+}
+
+// replay sends the spilled records, see spillQueue.startReplay. Live
+// records are spilled behind them until it is done, so that the agent
+// receives everything in order.
+func (u *UDPLogger) replay() {
+	u.spill.replay(func(lvl Lvl, metaK, metaV string, p []byte) error {
+		if !u.Reachable() {
+			return errAgentUnreachable
+		}
+		_, err := u.writeRecord(lvl, metaK, metaV, p)
+		if err != nil && u.tracksAgent() {
+			u.setReachable(false)
+		}
+		return err
+	})
+}
+
+func (u *UDPLogger) getConn() net.Conn {
+	u.connMu.RLock()
+	defer u.connMu.RUnlock()
+	return u.conn
+}
+
+// redial replaces the connection, dropping any error state the old socket
+// picked up from ICMP replies while the agent was gone.
+func (u *UDPLogger) redial() {
+	conn, err := net.Dial("udp", u.logAgentAddr)
+	if err != nil {
+		return
+	}
+	u.connMu.Lock()
+	old := u.conn
+	u.conn = conn
+	u.connMu.Unlock()
+	old.Close()
+}
+
+const (
+	MagicNum = 0xEEEF
+	Version  = 2
+)
+
+type MsgType uint8
+
+const (
+	Hello_Packet MsgType = iota
+	Data_Packet
+)
+
+type HelloPacket struct {
+	ServiceName string `json:"serviceName"`
+}
+
+func (u *UDPLogger) sayHello() {
+	body := HelloPacket{
+		ServiceName: u.who,
+	}
+	bodyBuf, _ := json.Marshal(&body)
+
+	e := udpBufferPool.Get().(*bytes.Buffer)
+	binary.Write(e, binary.BigEndian, uint16(MagicNum))
+	binary.Write(e, binary.BigEndian, u.version)
+	binary.Write(e, binary.BigEndian, uint8(Hello_Packet))
+	binary.Write(e, binary.BigEndian, uint16(len(bodyBuf)))
+
+	e.Write(bodyBuf)
+	u.send(e.Bytes())
+
+	e.Reset()
+	udpBufferPool.Put(e)
+}
+
+// Write sends p to the agent as a data packet at LvlInfo without meta.
+// It makes UDPLogger an io.Writer; use UDPHandler to have the level and
+// meta of the packet header taken from each record.
+func (u *UDPLogger) Write(p []byte) (n int, err error) {
+	return u.WriteRecord(LvlInfo, "", "", p)
+}
+
+// WriteRecord sends the formatted record body p to the agent as a data
+// packet whose header carries lvl and, unless both are empty, the meta
+// key/value pair.
+func (u *UDPLogger) WriteRecord(lvl Lvl, metaK, metaV string, p []byte) (n int, err error) {
+	if atomic.AddUint32(&u.count, 1) >= 100 {
+		atomic.StoreUint32(&u.count, 0)
+		u.sayHello()
+	}
+
+	if u.spill != nil {
+		if !u.Reachable() {
+			return len(p), u.spill.push(lvl, metaK, metaV, p)
+		}
+		if ok, err := u.spill.pushIfReplaying(lvl, metaK, metaV, p); ok {
+			return len(p), err
+		}
+	}
+
+	n, err = u.writeRecord(lvl, metaK, metaV, p)
+	if err != nil && u.tracksAgent() {
+		u.setReachable(false)
+		if u.spill != nil {
+			return len(p), u.spill.push(lvl, metaK, metaV, p)
+		}
+	}
+	return n, err
+}
+
+// writeRecord sends a record in the configured protocol version.
+func (u *UDPLogger) writeRecord(lvl Lvl, metaK, metaV string, p []byte) (int, error) {
+	if u.version == udpagent.Version3 {
+		return u.writeV3(lvl, metaK, metaV, p)
+	}
+	return u.writeV2(lvl, metaK, metaV, p)
+}
+
+func (u *UDPLogger) writeV2(lvl Lvl, metaK, metaV string, p []byte) (n int, err error) {
+
+	e := udpBufferPool.Get().(*bytes.Buffer)
+	binary.Write(e, binary.BigEndian, uint16(MagicNum))
+	binary.Write(e, binary.BigEndian, uint8(Version))
+	binary.Write(e, binary.BigEndian, uint8(Data_Packet))
+	binary.Write(e, binary.BigEndian, uint8(lvl)) // 256 levels are enough
+	if metaK == "" && metaV == "" {
+		binary.Write(e, binary.BigEndian, uint16(0))
+	} else {
+		metaBuf, err := json.Marshal(map[string]string{metaK: metaV})
+		if err == nil {
+			binary.Write(e, binary.BigEndian, uint16(len(metaBuf)))
+			e.Write(metaBuf)
+		} else {
+			binary.Write(e, binary.BigEndian, uint16(0))
+		}
+	}
+	e.Write(p)
+
+	b := e.Bytes()
+	length := e.Len()
+
+	var cursor = 0
+	for err == nil {
+		if length > cursor+1024 {
+			err = u.send(b[cursor : cursor+1024])
+			cursor = cursor + 1024
+		} else {
+			err = u.send(b[cursor:])
+			break
+		}
+	}
+
+	e.Reset()
+	udpBufferPool.Put(e)
+
+	return length, err
+}
+
+func (u *UDPLogger) writeV3(lvl Lvl, metaK, metaV string, p []byte) (int, error) {
+	var meta []byte
+	if metaK != "" || metaV != "" {
+		meta, _ = json.Marshal(map[string]string{metaK: metaV})
+	}
+
+	e := udpBufferPool.Get().(*bytes.Buffer)
+	e.Grow(3 + len(meta) + len(p))
+	payload := udpagent.AppendRecord(e.Bytes()[:0], uint8(lvl), meta, p)
+
+	u.mu.Lock()
+	err := u.packer.Add(payload, u.send)
+	u.mu.Unlock()
+
+	e.Reset()
+	udpBufferPool.Put(e)
+	return len(p), err
+}
+
+func (u *UDPLogger) send(datagram []byte) error {
+	_, err := u.getConn().Write(datagram)
+	return err
+}
+
+func (u *UDPLogger) flushLoop() {
+	t := time.NewTicker(u.batchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			u.Flush()
+		case <-u.quit:
+			return
+		}
+	}
+}
+
+// Flush sends the records batched by WithBatching right away.
+func (u *UDPLogger) Flush() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.packer.Flush(u.send)
+}
+
+func (u *UDPLogger) Close() error {
+	var err error
+	u.closeOnce.Do(func() {
+		close(u.quit)
+		u.Flush()
+		if u.spill != nil {
+			u.spill.close()
+		}
+		err = u.getConn().Close()
+	})
+	return err
+}
+
+type Option func(u *UDPLogger)
+
+func WithDstAddr(dstAddr string) Option {
+	return func(u *UDPLogger) {
+		u.logAgentAddr = dstAddr
+	}
+}
+
+// WithProtocolVersion selects the agent protocol: Version (2, the default)
+// or udpagent.Version3, which adds sequence numbers and fragment headers so
+// the agent can reassemble records longer than a datagram and detect loss.
+// The agent must understand the chosen version.
+func WithProtocolVersion(version uint8) Option {
+	return func(u *UDPLogger) {
+		u.version = version
+	}
+}
+
+// WithChecksum appends a CRC-32 to every datagram. Protocol version 3 only.
+func WithChecksum() Option {
+	return func(u *UDPLogger) {
+		u.packer.CRC = true
+	}
+}
+
+// WithBatching packs consecutive small records into shared datagrams which
+// are sent when full or at the latest after interval. Protocol version 3
+// only.
+func WithBatching(interval time.Duration) Option {
+	return func(u *UDPLogger) {
+		u.batchInterval = interval
+	}
+}
+
+// WithMaxDatagram sets the largest datagram sent, 1024 bytes by default.
+// It must be between udpagent.MinDatagram and udpagent.MaxDatagram bytes,
+// UDPHandler and NetFileHandler fail otherwise. Protocol version 3 only.
+func WithMaxDatagram(size int) Option {
+	return func(u *UDPLogger) {
+		u.packer.MaxDatagram = size
+	}
+}
+
+// WithHelloAck makes the logger wait up to timeout for the agent to
+// acknowledge the initial hello packet. If it doesn't, the agent is
+// considered unreachable until an acknowledgement arrives.
+func WithHelloAck(timeout time.Duration) Option {
+	return func(u *UDPLogger) {
+		u.ackTimeout = timeout
+	}
+}
+
+// WithHeartbeat sends a hello packet every interval and considers the agent
+// unreachable once three intervals pass without an acknowledgement. The
+// connection is re-established whenever the agent goes away.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(u *UDPLogger) {
+		u.heartbeat = interval
+	}
+}
+
+// WithAgentStateCallback registers fn to be called whenever the agent
+// becomes reachable or unreachable, e.g. to raise an alert.
+func WithAgentStateCallback(fn func(reachable bool)) Option {
+	return func(u *UDPLogger) {
+		u.onState = fn
+	}
+}
+
+// WithSpillFile appends the records logged while the agent is unreachable
+// to the file at path, at most maxBytes of them (unlimited if 0), and sends
+// them once the agent is back. Records left in the file by a previous run
+// are sent at startup. It only has an effect together with WithHelloAck or
+// WithHeartbeat.
+func WithSpillFile(path string, maxBytes int64) Option {
+	return func(u *UDPLogger) {
+		u.spill = newSpillQueue(path, maxBytes)
+	}
+}
+
+// WithFileOptions sets the rotation options of the local file written by
+// NetFileHandler.
+func WithFileOptions(opts ...FileOption) Option {
+	return func(u *UDPLogger) {
+		u.fileOpts = append(u.fileOpts, opts...)
+	}
+}
+
+func newUDPLogger(serviceName string, opts ...Option) (*UDPLogger, error) {
+	if serviceName == "" {
+		return nil, errors.New("serviceName illegal")
+	}
+	u := &UDPLogger{
+		who:     serviceName,
+		version: Version,
+	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	if u.logAgentAddr == "" {
+		u.logAgentAddr = "127.0.0.1:9999" //default
+	}
+	if u.version != Version && u.version != udpagent.Version3 {
+		return nil, fmt.Errorf("unsupported agent protocol version %d", u.version)
+	}
+	if size := u.packer.MaxDatagram; size != 0 && (size < udpagent.MinDatagram || size > udpagent.MaxDatagram) {
+		return nil, fmt.Errorf("max datagram size %d not within %d and %d bytes", size, udpagent.MinDatagram, udpagent.MaxDatagram)
+	}
+
+	if err := u.init(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UDPHandler returns a Handler which sends every record to the log agent
+// as serviceName. The packet header (level, meta) is built from the record
+// itself, so any Format may be used for the body.
+func UDPHandler(serviceName string, fmtr Format, opts ...Option) (Handler, error) {
+	u, err := newUDPLogger(serviceName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return LazyHandler(SyncHandler(&udpHandler{u, fmtr})), nil
+}
+
+type udpHandler struct {
+	u    *UDPLogger
+	fmtr Format
+}
+
+func (h *udpHandler) Log(r *Record) error {
+	_, err := h.u.WriteRecord(r.Lvl, r.MetaK, r.MetaV, h.fmtr.Format(r))
+	return err
+}
+
+func (h *udpHandler) Flush() error {
+	return h.u.Flush()
+}
+
+func (h *udpHandler) Close() error {
+	return h.u.Close()
+}
+
+func NetFileHandler(path, serviceName string, fmtr Format, opts ...Option) (Handler, error) {
+	u, err := newUDPLogger(serviceName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	//if needLocalLog {
+	f, err := openLogFile(path, u.fileOpts)
+	if err != nil {
+		u.Close()
+		return nil, err
+	}
+
+	// filte baseMonitor Meta Meassge in SelfStreamHandler()
+	return &closingHandler{f, MultiHandler(
+		NamedHandler("file", SelfStreamHandler(f, fmtr)),
+		NamedHandler("udp", LazyHandler(SyncHandler(&udpHandler{u, fmtr}))),
+	)}, nil
+
+	//return closingHandler{f, MultiHandler(StreamHandler(f, fmtr), StreamHandler(u, fmtr))}, nil
+	//} else {
+	//      return closingHandler{u, StreamHandler(u, fmtr)}, nil
+	//}
+}
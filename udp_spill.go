@@ -0,0 +1,233 @@
+package log15
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/xuexihuang/new_log15/udpagent"
+)
+
+var (
+	errSpillFull        = errors.New("log15: agent spill file is full")
+	errAgentUnreachable = errors.New("log15: agent is unreachable")
+)
+
+// spillQueue keeps the records that could not be sent while the agent was
+// unreachable in a file, each as a uint32 length followed by the record
+// payload of the agent protocol.
+type spillQueue struct {
+	mu        sync.Mutex
+	path      string
+	maxBytes  int64
+	f         *os.File
+	size      int64
+	dropped   uint64
+	replaying bool
+}
+
+func newSpillQueue(path string, maxBytes int64) *spillQueue {
+	return &spillQueue{path: path, maxBytes: maxBytes}
+}
+
+// push appends a record to the file.
+func (q *spillQueue) push(lvl Lvl, metaK, metaV string, p []byte) error {
+	_, err := q.add(lvl, metaK, metaV, p, false)
+	return err
+}
+
+// pushIfReplaying appends a record only while a replay is under way, so
+// that it is sent after the records spilled before it. It reports whether
+// it did.
+func (q *spillQueue) pushIfReplaying(lvl Lvl, metaK, metaV string, p []byte) (bool, error) {
+	return q.add(lvl, metaK, metaV, p, true)
+}
+
+func (q *spillQueue) add(lvl Lvl, metaK, metaV string, p []byte, onlyReplaying bool) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if onlyReplaying && !q.replaying {
+		return false, nil
+	}
+
+	var meta []byte
+	if metaK != "" || metaV != "" {
+		meta, _ = json.Marshal(map[string]string{metaK: metaV})
+	}
+	payload := udpagent.AppendRecord(make([]byte, 4, 7+len(meta)+len(p)), uint8(lvl), meta, p)
+	binary.BigEndian.PutUint32(payload, uint32(len(payload)-4))
+
+	if q.f == nil {
+		f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return true, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return true, err
+		}
+		q.f, q.size = f, info.Size()
+	}
+	if q.maxBytes > 0 && q.size+int64(len(payload)) > q.maxBytes {
+		q.dropped++
+		return true, errSpillFull
+	}
+	n, err := q.f.Write(payload)
+	q.size += int64(n)
+	return true, err
+}
+
+// startReplay marks a replay as under way, so that pushIfReplaying spills
+// the records logged from now on, and reports whether the caller is to run
+// it. It is false if another replay is under way already.
+func (q *spillQueue) startReplay() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.replaying {
+		return false
+	}
+	q.replaying = true
+	return true
+}
+
+// replay, called after startReplay, passes the spilled records to send in
+// the order they were spilled. The records spilled meanwhile are replayed
+// in turn, until the file stays empty. If send fails, replay stops and the
+// records not sent are put back in front of the file.
+func (q *spillQueue) replay(send func(lvl Lvl, metaK, metaV string, p []byte) error) error {
+	replayPath := q.path + ".replay"
+	for {
+		q.mu.Lock()
+		// a replay file left by a crash holds the oldest records
+		if _, err := os.Stat(replayPath); err == nil {
+			if err := q.requeue(replayPath, 0); err != nil {
+				q.replaying = false
+				q.mu.Unlock()
+				return err
+			}
+		}
+		if q.f != nil {
+			q.f.Close()
+			q.f, q.size = nil, 0
+		}
+		err := os.Rename(q.path, replayPath)
+		if err != nil {
+			q.replaying = false
+			q.mu.Unlock()
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		q.mu.Unlock()
+
+		sent, err := replayFile(replayPath, send)
+		if err != nil {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.replaying = false
+			return q.requeue(replayPath, sent)
+		}
+		if err := os.Remove(replayPath); err != nil {
+			q.mu.Lock()
+			q.replaying = false
+			q.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// replayFile passes the records in the file at path to send. If send
+// fails, it returns the error and the offset of the record not sent.
+// Truncated or malformed records end the file.
+func replayFile(path string, send func(lvl Lvl, metaK, metaV string, p []byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rd := bufio.NewReader(f)
+	var (
+		lenBuf [4]byte
+		off    int64
+	)
+	for {
+		if _, err := io.ReadFull(rd, lenBuf[:]); err != nil {
+			return off, nil
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+		if _, err := io.ReadFull(rd, payload); err != nil {
+			return off, nil
+		}
+		rec, err := udpagent.DecodeRecord(payload)
+		if err == nil {
+			var metaK, metaV string
+			for k, v := range rec.Meta {
+				metaK, metaV = k, v
+				break // a record has at most one meta pair
+			}
+			if err := send(Lvl(rec.Level), metaK, metaV, rec.Body); err != nil {
+				return off, err
+			}
+		}
+		off += int64(len(lenBuf) + len(payload))
+	}
+}
+
+// requeue puts the records of the replay file at path from offset off back
+// in front of the records spilled since. q.mu must be held.
+func (q *spillQueue) requeue(path string, off int64) error {
+	if q.f != nil {
+		q.f.Close()
+		q.f, q.size = nil, 0
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmpPath := q.path + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if spilled, e := os.Open(q.path); e == nil {
+		if err == nil {
+			_, err = io.Copy(dst, spilled)
+		}
+		spilled.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (q *spillQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.f == nil {
+		return nil
+	}
+	err := q.f.Close()
+	q.f = nil
+	return err
+}
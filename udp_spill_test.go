@@ -0,0 +1,94 @@
+package log15
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSpillQueueReplay(t *testing.T) {
+	q := newSpillQueue(filepath.Join(t.TempDir(), "spill"), 0)
+	for _, msg := range []string{"1", "2", "3"} {
+		if err := q.push(LvlInfo, "", "", []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, _ := q.pushIfReplaying(LvlInfo, "", "", []byte("live")); ok {
+		t.Fatal("record spilled without a replay")
+	}
+
+	// the agent goes away after the first record, while "4" is logged
+	var sent []string
+	fail := errors.New("unreachable")
+	if !q.startReplay() {
+		t.Fatal("replay not started")
+	}
+	err := q.replay(func(lvl Lvl, metaK, metaV string, p []byte) error {
+		if len(sent) == 1 {
+			if ok, err := q.pushIfReplaying(LvlInfo, "", "", []byte("4")); !ok || err != nil {
+				t.Errorf("live record not spilled during the replay: %v", err)
+			}
+			return fail
+		}
+		sent = append(sent, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rest comes back in order, followed by what was logged meanwhile
+	q.push(LvlWarn, "k", "v", []byte("5"))
+	if !q.startReplay() {
+		t.Fatal("replay not started")
+	}
+	var meta []string
+	err = q.replay(func(lvl Lvl, metaK, metaV string, p []byte) error {
+		sent = append(sent, string(p))
+		meta = append(meta, metaK+metaV)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3", "4", "5"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if want := []string{"", "", "", "kv"}; !reflect.DeepEqual(meta, want) {
+		t.Errorf("meta %q, want %q", meta, want)
+	}
+	if ok, _ := q.pushIfReplaying(LvlInfo, "", "", []byte("live")); ok {
+		t.Error("record spilled after the replay")
+	}
+	q.close()
+}
+
+func TestSpillQueueLeftoverReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill")
+	q := newSpillQueue(path, 0)
+	q.push(LvlInfo, "", "", []byte("old"))
+	q.close()
+	// a crash during a replay left the file behind
+	if err := os.Rename(path, path+".replay"); err != nil {
+		t.Fatal(err)
+	}
+	q.push(LvlInfo, "", "", []byte("new"))
+
+	var sent []string
+	q.startReplay()
+	err := q.replay(func(lvl Lvl, metaK, metaV string, p []byte) error {
+		sent = append(sent, string(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"old", "new"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if _, err := os.Stat(path + ".replay"); !os.IsNotExist(err) {
+		t.Errorf("replay file left: %v", err)
+	}
+}
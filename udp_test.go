@@ -0,0 +1,116 @@
+package log15
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuexihuang/new_log15/udpagent"
+)
+
+// udpProxy forwards datagrams to the agent at addr, passing each through
+// alter first, which may change it or return nil to drop it.
+func udpProxy(t *testing.T, addr string, alter func([]byte) []byte) net.PacketConn {
+	in, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer out.Close()
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := in.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if b := alter(buf[:n]); b != nil {
+				out.Write(b)
+			}
+		}
+	}()
+	return in
+}
+
+func TestUDPHandlerToAgent(t *testing.T) {
+	recs := make(chan udpagent.Record, 128)
+	agent, err := udpagent.Listen("127.0.0.1:0", func(r udpagent.Record) { recs <- r })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	// corrupt record 2 and drop record 3 on the way
+	proxy := udpProxy(t, agent.Addr().String(), func(b []byte) []byte {
+		p, err := udpagent.Decode(b)
+		if err != nil || p.Type != udpagent.DataPacket {
+			return b
+		}
+		switch p.Frames[0].Seq {
+		case 2:
+			b[len(b)-5] ^= 0xff
+		case 3:
+			return nil
+		}
+		return b
+	})
+	defer proxy.Close()
+
+	h, err := UDPHandler("svc", FormatFunc(func(r *Record) []byte { return []byte(r.Msg) }),
+		WithDstAddr(proxy.LocalAddr().String()),
+		WithProtocolVersion(udpagent.Version3),
+		WithChecksum(),
+		WithMaxDatagram(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(h)
+
+	long := strings.Repeat("0123456789", 30)
+	msgs := []string{long, "corrupted", "dropped"}
+	for len(msgs) < 70 {
+		msgs = append(msgs, "short")
+	}
+	for _, msg := range msgs {
+		if err := h.Log(&Record{Time: time.Now(), Lvl: LvlWarn, Msg: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []udpagent.Record
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(msgs)-2 {
+		select {
+		case r := <-recs:
+			got = append(got, r)
+		case <-timeout:
+			t.Fatalf("received %d records, want %d", len(got), len(msgs)-2)
+		}
+	}
+
+	if r := got[0]; string(r.Body) != long || r.Seq != 1 || r.Service != "svc" || r.Level != uint8(LvlWarn) {
+		t.Errorf("fragmented record: seq %d service %q level %d body %q", r.Seq, r.Service, r.Level, r.Body)
+	}
+	if seq := got[1].Seq; seq != 4 {
+		t.Errorf("record after the gap has seq %d, want 4", seq)
+	}
+	stats := agent.Stats()
+	if stats.BadPackets != 1 {
+		t.Errorf("bad packets %d, want 1 for the checksum mismatch", stats.BadPackets)
+	}
+	if stats.Lost != 2 {
+		t.Errorf("lost %d, want 2", stats.Lost)
+	}
+}
+
+func TestUDPHandlerMaxDatagram(t *testing.T) {
+	for _, size := range []int{-1, udpagent.MinDatagram - 1, udpagent.MaxDatagram + 1} {
+		if _, err := UDPHandler("svc", LogfmtFormat(), WithMaxDatagram(size)); err == nil {
+			t.Errorf("WithMaxDatagram(%d) accepted", size)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package udpagent
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+// HelloAck is what the agent sends back for every hello packet.
+var HelloAck = []byte{0xEF, 0xEE}
+
+// AgentStats counts what an Agent has received.
+type AgentStats struct {
+	Hellos     uint64
+	Records    uint64
+	Lost       uint64
+	BadPackets uint64
+}
+
+// An Agent is a minimal log agent: it acknowledges hellos, reassembles
+// records from every sender and passes them to a callback. It is meant for
+// tests and local debugging, see cmd/log15-agent.
+type Agent struct {
+	conn net.PacketConn
+	fn   func(Record)
+
+	mu      sync.Mutex
+	senders map[string]*sender
+	stats   AgentStats
+	done    chan struct{}
+}
+
+type sender struct {
+	service string
+	ra      Reassembler
+}
+
+// Listen starts an Agent on the UDP address addr, e.g. "127.0.0.1:9999" or
+// "127.0.0.1:0" for a random port. fn is called from the agent's goroutine
+// for each complete record.
+func Listen(addr string, fn func(Record)) (*Agent, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{
+		conn:    conn,
+		fn:      fn,
+		senders: make(map[string]*sender),
+		done:    make(chan struct{}),
+	}
+	go a.serve()
+	return a, nil
+}
+
+// Addr returns the address the agent listens on.
+func (a *Agent) Addr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// Stats returns the agent's counters.
+func (a *Agent) Stats() AgentStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := a.stats
+	for _, s := range a.senders {
+		stats.Lost += s.ra.Lost()
+	}
+	return stats
+}
+
+// Close stops the agent.
+func (a *Agent) Close() error {
+	err := a.conn.Close()
+	<-a.done
+	return err
+}
+
+func (a *Agent) serve() {
+	defer close(a.done)
+	buf := make([]byte, 65536)
+	lastExpire := time.Now()
+	for {
+		n, from, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		a.handle(buf[:n], from)
+
+		if now := time.Now(); now.Sub(lastExpire) > time.Second {
+			a.mu.Lock()
+			for _, s := range a.senders {
+				s.ra.Expire(now)
+			}
+			a.mu.Unlock()
+			lastExpire = now
+		}
+	}
+}
+
+func (a *Agent) handle(b []byte, from net.Addr) {
+	p, err := Decode(b)
+
+	a.mu.Lock()
+	if err != nil {
+		a.stats.BadPackets++
+		a.mu.Unlock()
+		return
+	}
+	s := a.senders[from.String()]
+	if s == nil {
+		s = &sender{}
+		a.senders[from.String()] = s
+	}
+
+	if p.Type == HelloPacket {
+		a.stats.Hellos++
+		var hello struct {
+			ServiceName string `json:"serviceName"`
+		}
+		if json.Unmarshal(p.Hello, &hello) == nil {
+			s.service = hello.ServiceName
+		}
+		a.mu.Unlock()
+		a.conn.WriteTo(HelloAck, from)
+		return
+	}
+
+	var recs []Record
+	for _, f := range p.Frames {
+		payload, ok := s.ra.Add(f)
+		if !ok {
+			continue
+		}
+		rec, err := DecodeRecord(payload)
+		if err != nil {
+			a.stats.BadPackets++
+			continue
+		}
+		rec.Service, rec.Version, rec.Seq = s.service, p.Version, f.Seq
+		recs = append(recs, rec)
+		a.stats.Records++
+	}
+	a.mu.Unlock()
+
+	for _, rec := range recs {
+		a.fn(rec)
+	}
+}
@@ -0,0 +1,292 @@
+// Package udpagent implements both ends of the UDP protocol NetFileHandler
+// and UDPHandler use to ship records to a local log agent: the encoder used
+// by the log15 package, a decoder with fragment reassembly, and a minimal
+// Agent for testing a service end to end.
+//
+// Every datagram starts with the same four bytes:
+//
+//     magic uint16 (0xEEEF) | version uint8 | type uint8
+//
+// A hello packet continues with bodyLen uint16 and a JSON body
+// {"serviceName": "..."}. The agent answers it with the two bytes 0xEF 0xEE.
+//
+// In version 2 a data packet continues with the record payload directly, and
+// datagrams are cut every 1024 bytes without any further header, so payloads
+// over 1 KB can not be reassembled.
+//
+// In version 3 a data packet continues with
+//
+//     flags uint8 | frameCount uint8 | frame... | [crc32 uint32]
+//
+// where each frame is
+//
+//     seq uint32 | index uint16 | count uint16 | len uint16 | data [len]byte
+//
+// seq numbers records per sender, index/count place a fragment within its
+// record, and several complete small records may share one datagram. When
+// FlagCRC is set the datagram ends with the IEEE CRC-32 of all bytes before
+// it.
+//
+// In both versions the record payload, reassembled from its fragments, is
+//
+//     level uint8 | metaLen uint16 | meta [metaLen]byte (JSON object) | body
+package udpagent
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	MagicNum = 0xEEEF
+	Version2 = 2
+	Version3 = 3
+)
+
+// Packet types
+const (
+	HelloPacket uint8 = iota
+	DataPacket
+)
+
+// Flags of a version 3 data packet
+const (
+	FlagCRC uint8 = 1 << iota
+)
+
+// DefaultMaxDatagram is the datagram size used unless configured otherwise.
+// It matches the chunk size of version 2.
+const DefaultMaxDatagram = 1024
+
+const (
+	commonHeaderLen = 4 // magic, version, type
+	dataHeaderLen   = commonHeaderLen + 2
+	frameHeaderLen  = 10
+	crcLen          = 4
+	maxFrames       = 255
+)
+
+// MinDatagram and MaxDatagram bound Packer.MaxDatagram. The smallest
+// datagram holds the headers of a single frame, its checksum and one byte
+// of payload; the largest is the biggest UDP payload over IPv4.
+const (
+	MinDatagram = dataHeaderLen + frameHeaderLen + crcLen + 1
+	MaxDatagram = 65507
+)
+
+var (
+	ErrShort       = errors.New("udpagent: packet too short")
+	ErrBadMagic    = errors.New("udpagent: bad magic number")
+	ErrBadVersion  = errors.New("udpagent: unsupported version")
+	ErrBadType     = errors.New("udpagent: unknown packet type")
+	ErrBadChecksum = errors.New("udpagent: checksum mismatch")
+	ErrDatagramLen = errors.New("udpagent: datagram size out of range")
+)
+
+// AppendHello appends a hello packet announcing serviceName.
+func AppendHello(dst []byte, version uint8, body []byte) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, MagicNum)
+	dst = append(dst, version, HelloPacket)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(body)))
+	return append(dst, body...)
+}
+
+// AppendRecord appends the record payload shared by all versions.
+func AppendRecord(dst []byte, level uint8, meta, body []byte) []byte {
+	dst = append(dst, level)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(meta)))
+	dst = append(dst, meta...)
+	return append(dst, body...)
+}
+
+// A Packer cuts version 3 record payloads into datagrams. It is not safe
+// for concurrent use.
+type Packer struct {
+	// MaxDatagram is the largest datagram emitted, DefaultMaxDatagram if 0.
+	// Add fails with ErrDatagramLen unless it is between MinDatagram and
+	// MaxDatagram.
+	MaxDatagram int
+	// CRC appends a checksum to every datagram.
+	CRC bool
+	// Batch keeps small records in a pending datagram until it is full or
+	// Flush is called, instead of emitting each record right away.
+	Batch bool
+
+	seq     uint32
+	pending []byte
+	frames  int
+}
+
+func (p *Packer) maxDatagram() int {
+	if p.MaxDatagram <= 0 {
+		return DefaultMaxDatagram
+	}
+	return p.MaxDatagram
+}
+
+// room is the largest frame payload which fits a datagram alone.
+func (p *Packer) room() int {
+	return p.maxDatagram() - dataHeaderLen - frameHeaderLen - crcLen
+}
+
+// Add numbers payload with the next sequence number and passes every
+// datagram that becomes complete to emit. The datagram slice is only valid
+// during the call.
+func (p *Packer) Add(payload []byte, emit func(datagram []byte) error) error {
+	if size := p.maxDatagram(); size < MinDatagram || size > MaxDatagram {
+		return ErrDatagramLen
+	}
+	p.seq++
+	room := p.room()
+
+	if len(payload) <= room {
+		if p.frames > 0 && len(p.pending)+frameHeaderLen+len(payload)+crcLen > p.maxDatagram() {
+			if err := p.Flush(emit); err != nil {
+				return err
+			}
+		}
+		p.appendFrame(p.seq, 0, 1, payload)
+		if !p.Batch || p.frames == maxFrames {
+			return p.Flush(emit)
+		}
+		return nil
+	}
+
+	if err := p.Flush(emit); err != nil {
+		return err
+	}
+	count := (len(payload) + room - 1) / room
+	if count > 0xFFFF {
+		return errors.New("udpagent: record too large")
+	}
+	for i := 0; i < count; i++ {
+		end := (i + 1) * room
+		if end > len(payload) {
+			end = len(payload)
+		}
+		p.appendFrame(p.seq, uint16(i), uint16(count), payload[i*room:end])
+		if err := p.Flush(emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Packer) appendFrame(seq uint32, index, count uint16, data []byte) {
+	if p.frames == 0 {
+		var flags uint8
+		if p.CRC {
+			flags |= FlagCRC
+		}
+		p.pending = binary.BigEndian.AppendUint16(p.pending[:0], MagicNum)
+		p.pending = append(p.pending, Version3, DataPacket, flags, 0)
+	}
+	p.pending = binary.BigEndian.AppendUint32(p.pending, seq)
+	p.pending = binary.BigEndian.AppendUint16(p.pending, index)
+	p.pending = binary.BigEndian.AppendUint16(p.pending, count)
+	p.pending = binary.BigEndian.AppendUint16(p.pending, uint16(len(data)))
+	p.pending = append(p.pending, data...)
+	p.frames++
+	p.pending[dataHeaderLen-1] = uint8(p.frames)
+}
+
+// Flush emits the pending datagram, if any.
+func (p *Packer) Flush(emit func(datagram []byte) error) error {
+	if p.frames == 0 {
+		return nil
+	}
+	if p.CRC {
+		p.pending = binary.BigEndian.AppendUint32(p.pending, crc32.ChecksumIEEE(p.pending))
+	}
+	p.frames = 0
+	return emit(p.pending)
+}
+
+// Packet is a decoded datagram.
+type Packet struct {
+	Version uint8
+	Type    uint8
+	Hello   []byte  // JSON body of a hello packet
+	Frames  []Frame // fragments of a data packet
+}
+
+// Frame is one fragment of a record payload. Version 2 packets decode to a
+// single frame with Seq 0 and Count 1.
+type Frame struct {
+	Seq   uint32
+	Index uint16
+	Count uint16
+	Data  []byte
+}
+
+// Decode parses a datagram. The returned packet references b.
+func Decode(b []byte) (*Packet, error) {
+	if len(b) < commonHeaderLen {
+		return nil, ErrShort
+	}
+	if binary.BigEndian.Uint16(b) != MagicNum {
+		return nil, ErrBadMagic
+	}
+	p := &Packet{Version: b[2], Type: b[3]}
+	if p.Version != Version2 && p.Version != Version3 {
+		return nil, ErrBadVersion
+	}
+
+	switch p.Type {
+	case HelloPacket:
+		if len(b) < commonHeaderLen+2 {
+			return nil, ErrShort
+		}
+		n := int(binary.BigEndian.Uint16(b[commonHeaderLen:]))
+		if len(b) < commonHeaderLen+2+n {
+			return nil, ErrShort
+		}
+		p.Hello = b[commonHeaderLen+2 : commonHeaderLen+2+n]
+		return p, nil
+	case DataPacket:
+	default:
+		return nil, ErrBadType
+	}
+
+	if p.Version == Version2 {
+		p.Frames = []Frame{{Count: 1, Data: b[commonHeaderLen:]}}
+		return p, nil
+	}
+
+	if len(b) < dataHeaderLen {
+		return nil, ErrShort
+	}
+	flags, n := b[4], int(b[5])
+	if flags&FlagCRC != 0 {
+		if len(b) < dataHeaderLen+crcLen {
+			return nil, ErrShort
+		}
+		sum := binary.BigEndian.Uint32(b[len(b)-crcLen:])
+		b = b[:len(b)-crcLen]
+		if crc32.ChecksumIEEE(b) != sum {
+			return nil, ErrBadChecksum
+		}
+	}
+	b = b[dataHeaderLen:]
+	p.Frames = make([]Frame, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) < frameHeaderLen {
+			return nil, ErrShort
+		}
+		f := Frame{
+			Seq:   binary.BigEndian.Uint32(b),
+			Index: binary.BigEndian.Uint16(b[4:]),
+			Count: binary.BigEndian.Uint16(b[6:]),
+		}
+		l := int(binary.BigEndian.Uint16(b[8:]))
+		b = b[frameHeaderLen:]
+		if len(b) < l || f.Count == 0 || f.Index >= f.Count {
+			return nil, ErrShort
+		}
+		f.Data = b[:l]
+		b = b[l:]
+		p.Frames = append(p.Frames, f)
+	}
+	return p, nil
+}
@@ -0,0 +1,168 @@
+package udpagent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+)
+
+// Record is a reassembled log record.
+type Record struct {
+	Service string            // service name from the sender's last hello
+	Version uint8             // protocol version it was sent with
+	Seq     uint32            // sequence number, 0 for version 2
+	Level   uint8             // log15.Lvl of the record
+	Meta    map[string]string // meta key/value pair, if any
+	Body    []byte            // the record as formatted by the sender
+}
+
+// DecodeRecord parses a reassembled record payload.
+func DecodeRecord(payload []byte) (Record, error) {
+	var r Record
+	if len(payload) < 3 {
+		return r, ErrShort
+	}
+	r.Level = payload[0]
+	n := int(binary.BigEndian.Uint16(payload[1:]))
+	payload = payload[3:]
+	if len(payload) < n {
+		return r, ErrShort
+	}
+	if n > 0 {
+		if err := json.Unmarshal(payload[:n], &r.Meta); err != nil {
+			return r, err
+		}
+	}
+	r.Body = append([]byte(nil), payload[n:]...)
+	return r, nil
+}
+
+// A Reassembler rebuilds records from the frames of one sender and keeps
+// track of sequence numbers that never arrived. Datagrams may be
+// reordered: a skipped sequence number only counts as lost once it falls
+// more than Window behind the highest one seen, or stays missing for
+// Timeout. It is not safe for concurrent use.
+type Reassembler struct {
+	// Timeout after which an incomplete record or a missing sequence
+	// number is given up, 5s if 0.
+	Timeout time.Duration
+	// Window is how far behind the highest sequence number a record may
+	// arrive, 64 if 0.
+	Window uint32
+
+	partial map[uint32]*partial
+	missing map[uint32]time.Time // skipped sequence numbers, when skipped
+	maxSeq  uint32
+	lost    uint64
+}
+
+type partial struct {
+	frags    [][]byte
+	received int
+	first    time.Time
+}
+
+// Add takes a frame and returns the record payload once all of its
+// fragments have arrived.
+func (ra *Reassembler) Add(f Frame) ([]byte, bool) {
+	if f.Seq != 0 {
+		ra.track(f.Seq, time.Now())
+	}
+	if f.Count <= 1 {
+		return f.Data, true
+	}
+
+	if ra.partial == nil {
+		ra.partial = make(map[uint32]*partial)
+	}
+	p := ra.partial[f.Seq]
+	if p == nil {
+		p = &partial{frags: make([][]byte, f.Count), first: time.Now()}
+		ra.partial[f.Seq] = p
+	}
+	if int(f.Index) >= len(p.frags) || p.frags[f.Index] != nil {
+		return nil, false
+	}
+	p.frags[f.Index] = append([]byte(nil), f.Data...)
+	p.received++
+	if p.received < len(p.frags) {
+		return nil, false
+	}
+
+	delete(ra.partial, f.Seq)
+	var payload []byte
+	for _, frag := range p.frags {
+		payload = append(payload, frag...)
+	}
+	return payload, true
+}
+
+// track notes that seq arrived. The sequence numbers skipped on the way to
+// a new highest one are missing until they arrive late, and lost once they
+// fall more than the window behind.
+func (ra *Reassembler) track(seq uint32, now time.Time) {
+	if ra.maxSeq == 0 {
+		ra.maxSeq = seq
+		return
+	}
+	if seq <= ra.maxSeq {
+		delete(ra.missing, seq)
+		return
+	}
+
+	window := ra.Window
+	if window == 0 {
+		window = 64
+	}
+	if ra.missing == nil {
+		ra.missing = make(map[uint32]time.Time)
+	}
+	from := ra.maxSeq + 1
+	if seq-from > window {
+		// skipped past the window already
+		ra.lost += uint64(seq - window - from)
+		from = seq - window
+	}
+	for s := from; s < seq; s++ {
+		ra.missing[s] = now
+	}
+	ra.maxSeq = seq
+
+	for s := range ra.missing {
+		if seq-s > window {
+			delete(ra.missing, s)
+			ra.lost++
+		}
+	}
+}
+
+// Expire drops incomplete records and missing sequence numbers older than
+// the timeout and counts them as lost. It returns how many were dropped.
+func (ra *Reassembler) Expire(now time.Time) int {
+	timeout := ra.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	n := 0
+	for seq, p := range ra.partial {
+		if now.Sub(p.first) > timeout {
+			delete(ra.partial, seq)
+			n++
+		}
+	}
+	for seq, skipped := range ra.missing {
+		if now.Sub(skipped) > timeout {
+			delete(ra.missing, seq)
+			n++
+		}
+	}
+	ra.lost += uint64(n)
+	return n
+}
+
+// Lost returns the number of records known to be missing: sequence numbers
+// skipped and not seen within the window or the timeout, plus expired
+// incomplete records.
+func (ra *Reassembler) Lost() uint64 {
+	return ra.lost
+}
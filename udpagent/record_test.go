@@ -0,0 +1,42 @@
+package udpagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReassemblerReorder(t *testing.T) {
+	ra := &Reassembler{Window: 4}
+	for _, seq := range []uint32{1, 3, 4, 2, 5} {
+		if _, ok := ra.Add(Frame{Seq: seq, Count: 1}); !ok {
+			t.Fatalf("seq %d: record not complete", seq)
+		}
+	}
+	if n := ra.Lost(); n != 0 {
+		t.Fatalf("lost %d after reordering, want 0", n)
+	}
+
+	// 6 never arrives
+	for seq := uint32(7); seq <= 10; seq++ {
+		ra.Add(Frame{Seq: seq, Count: 1})
+	}
+	if n := ra.Lost(); n != 0 {
+		t.Fatalf("lost %d within the window, want 0", n)
+	}
+	ra.Add(Frame{Seq: 11, Count: 1})
+	if n := ra.Lost(); n != 1 {
+		t.Fatalf("lost %d past the window, want 1", n)
+	}
+
+	// a jump past the window counts what it skipped right away
+	ra.Add(Frame{Seq: 30, Count: 1})
+	if n := ra.Lost(); n != 1+14 {
+		t.Fatalf("lost %d after a jump, want 15", n)
+	}
+	if n := ra.Expire(time.Now().Add(time.Minute)); n != 4 {
+		t.Fatalf("expired %d, want 4", n)
+	}
+	if n := ra.Lost(); n != 1+18 {
+		t.Fatalf("lost %d after expiring, want 19", n)
+	}
+}